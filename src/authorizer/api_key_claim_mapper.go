@@ -1,31 +1,145 @@
 package authorizer
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru/v2"
 	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/server/common/authorization"
 	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
 )
 
-// apiKeyClaimMapper implements authorization.ClaimMapper only
+// apiKeyClaimMapper implements authorization.ClaimMapper and Reloader
 type apiKeyClaimMapper struct {
 	logger logpkg.Logger
-	keys   map[string]*authorization.Claims
+	now    func() time.Time
+	load   func() (*apiKeySet, error)
+	// set is swapped as a whole on reload, a loaded set is never modified
+	set atomic.Pointer[apiKeySet]
+	// revocations is the registry file mapper whose revoked list also applies to these keys, see ShareAPIKeyRevocations
+	revocations *apiKeyClaimMapper
+}
+
+// apiKeySet is the active keys by ID and the revocation list which takes priority over them
+type apiKeySet struct {
+	keys map[string]*apiKey
+	// revoked key IDs and "sha256:<hex>" digests of presented tokens
+	revoked map[string]revocation
+	// plaintext keys by plaintextKeyMAC, built by index
+	plaintext map[[sha256.Size]byte]*apiKey
+	// verified hashed keys by plaintextKeyMAC of the presented token, so argon2id and bcrypt run once per token.
+	// Only successful verifications are cached, a reload starts with an empty cache.
+	verified *lru.Cache[[sha256.Size]byte, *apiKey]
+}
+
+// verifiedKeysCacheSize bounds the cache of verified hashed key tokens
+const verifiedKeysCacheSize = 1024
+
+// index indexes the plaintext keys by their MAC so a presented token is never compared by its raw value,
+// and records the key ID in the claims of every key (see ClaimsExtensions.KeyID)
+func (s *apiKeySet) index() {
+	s.verified, _ = lru.New[[sha256.Size]byte, *apiKey](verifiedKeysCacheSize)
+	s.plaintext = make(map[[sha256.Size]byte]*apiKey)
+	for id, key := range s.keys {
+		extensionsOf(key.claims).KeyID = id
+		if v, ok := key.verifier.(*hmacVerifier); ok && !key.hashed {
+			s.plaintext[v.mac] = key
+		}
+	}
+}
+
+// apiKey is a single configured key, indexed by its ID. The secret itself is never kept.
+type apiKey struct {
+	id       string
+	hashed   bool
+	verifier secretVerifier
+	claims   *authorization.Claims
+	// deprecatedSystemGrant is set when the key uses "*" instead of "@system"
+	deprecatedSystemGrant bool
+
+	// registry file only
+	description string
+	owner       string
+	metadata    map[string]string
+	notBefore   time.Time
+	expiresAt   time.Time
+}
+
+type revocation struct {
+	reason    string
+	revokedAt time.Time
 }
 
 // NewAPIKeyClaimMapper creates a new apiKeyClaimMapper with the given logger and loads API key configuration from environment.
 func NewAPIKeyClaimMapper(apiKeysString string, logger logpkg.Logger) (authorization.ClaimMapper, error) {
-	keys, err := parseAPIKeysString(apiKeysString)
+	m, err := newAPIKeyClaimMapper(func() (*apiKeySet, error) {
+		keys, err := parseAPIKeysString(apiKeysString)
+		return &apiKeySet{keys: keys}, err
+	}, logger)
 	if err != nil {
 		return nil, err
 	}
+	for id, key := range m.set.Load().keys {
+		if key.deprecatedSystemGrant {
+			logger.Warn(`auth: api key grants a system role with the deprecated "*" namespace, use "@system" instead, or "@all" for every namespace without cluster-level access`,
+				tag.NewStringTag("key-id", id))
+		}
+	}
 	logger.Info("API key claim-mapper initialized")
-	return &apiKeyClaimMapper{logger: logger, keys: keys}, nil
+	return m, nil
+}
+
+func newAPIKeyClaimMapper(load func() (*apiKeySet, error), logger logpkg.Logger) (*apiKeyClaimMapper, error) {
+	set, err := load()
+	if err != nil {
+		return nil, err
+	}
+	m := &apiKeyClaimMapper{logger: logger, now: time.Now, load: load}
+	m.warnExpired(set)
+	set.index()
+	m.set.Store(set)
+	return m, nil
+}
+
+// Reload loads the keys again and swaps them atomically, on error the previous keys stay active
+func (m *apiKeyClaimMapper) Reload() error {
+	set, err := m.load()
+	if err != nil {
+		m.logger.Warn("auth: api keys reload failed, keeping previous keys", tag.Error(err))
+		return err
+	}
+	m.warnExpired(set)
+	set.index()
+	m.set.Store(set)
+	m.logger.Info("auth: api keys reloaded", tag.NewInt("keys", len(set.keys)), tag.NewInt("revoked", len(set.revoked)))
+	return nil
+}
+
+// warnExpired logs keys which are expired already so they can be cleaned up
+func (m *apiKeyClaimMapper) warnExpired(set *apiKeySet) {
+	now := m.now()
+	for id, key := range set.keys {
+		if !key.expiresAt.IsZero() && !now.Before(key.expiresAt) {
+			m.logger.Warn("auth: api key expired, remove it from the configuration",
+				tag.NewStringTag("key-id", id), tag.NewTimeTag("expires-at", key.expiresAt))
+		}
+	}
 }
 
 // GetClaims extracts API key from Authorization header and maps to Claims.
+// Hashed keys are presented as "<keyID>.<secret>" or as a structured key "tmprl_<keyID>_<secret>_<checksum>",
+// plaintext keys as is.
+// Secrets are only compared in constant time: hashed keys are looked up by their public key ID,
+// plaintext keys by the peppered MAC of the presented token.
+// A revoked key, or one outside of its validity window, is rejected with a terminal error,
+// so no other claim mapper gets to accept it.
 func (m *apiKeyClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
 	if authInfo == nil || authInfo.AuthToken == "" {
 		return nil, nil
@@ -37,44 +151,182 @@ func (m *apiKeyClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*author
 	if !strings.EqualFold(parts[0], authorizationBearer) {
 		return nil, serviceerror.NewPermissionDenied("unexpected name in authorization token", "")
 	}
-	key := strings.TrimSpace(parts[1])
+	token := strings.TrimSpace(parts[1])
+	set := m.set.Load()
+	digest, mac := sha256.Sum256([]byte(token)), plaintextKeyMAC(token)
+	id, secret, hasID := strings.Cut(token, apiKeyIDSeparator)
+	if !hasID {
+		id = ""
+	}
+	if strings.HasPrefix(token, apiKeyTokenPrefix) {
+		// a structured key is checked before any lookup, a typo is rejected by its checksum
+		var err error
+		if id, secret, err = parseAPIKeyToken(token); err != nil {
+			m.logger.Warn("auth: malformed api key rejected", tag.NewStringTag("key-id", id), tag.Error(err))
+			return nil, newTerminalError(withReason(rejectionReason(err), serviceerror.NewPermissionDenied(err.Error(), "")))
+		}
+		hasID = true
+	}
 
-	if claims, ok := m.keys[key]; ok {
-		return claims, nil
+	if set.isRevoked(digest, mac, id) || (m.revocations != nil && m.revocations.set.Load().isRevoked(digest, mac, id)) {
+		keyID := id
+		if keyID == "" {
+			keyID = plaintextKeyID(mac)
+		}
+		m.logger.Warn("auth: revoked api key presented", tag.NewStringTag("key-id", keyID))
+		return nil, newTerminalError(withReason(reasonRevoked, serviceerror.NewPermissionDenied("api key revoked", "")))
+	}
+	if hasID {
+		if key, ok := set.keys[id]; ok && key.hashed {
+			if !set.verify(key, secret, mac) {
+				m.logger.Warn("auth: invalid api key secret", tag.NewStringTag("key-id", id))
+				return nil, withReason(reasonInvalidSecret, serviceerror.NewPermissionDenied("invalid api key", ""))
+			}
+			if err := key.checkValidity(m.now()); err != nil {
+				m.logger.Warn("auth: api key outside of its validity window", tag.NewStringTag("key-id", id), tag.Error(err))
+				return nil, err
+			}
+			m.logger.Debug("auth: api key accepted", tag.NewStringTag("key-id", id))
+			return key.claims, nil
+		}
+	}
+	if key, ok := set.plaintext[mac]; ok && key.verifier.verify(token) {
+		if err := key.checkValidity(m.now()); err != nil {
+			m.logger.Warn("auth: api key outside of its validity window", tag.NewStringTag("key-id", key.id), tag.Error(err))
+			return nil, err
+		}
+		return key.claims, nil
 	}
 	return nil, nil
 }
 
-func parseAPIKeysString(apiKeysStr string) (map[string]*authorization.Claims, error) {
-	keys := make(map[string]*authorization.Claims)
+// verify checks the secret of a hashed key, a token verified before is not hashed again
+func (s *apiKeySet) verify(key *apiKey, secret string, mac [sha256.Size]byte) bool {
+	if s.verified != nil {
+		if verified, ok := s.verified.Get(mac); ok && verified == key {
+			return true
+		}
+	}
+	if !key.verifier.verify(secret) {
+		return false
+	}
+	if s.verified != nil {
+		s.verified.Add(mac, key)
+	}
+	return true
+}
+
+// isRevoked checks the presented token digest, its derived plaintext key ID and the key ID it carries (if any)
+func (s *apiKeySet) isRevoked(digest, mac [sha256.Size]byte, id string) bool {
+	if len(s.revoked) == 0 {
+		return false
+	}
+	if _, ok := s.revoked[revokedDigestPrefix+hex.EncodeToString(digest[:])]; ok {
+		return true
+	}
+	if _, ok := s.revoked[plaintextKeyID(mac)]; ok {
+		return true
+	}
+	_, ok := s.revoked[id]
+	return ok && id != ""
+}
+
+// checkValidity rejects a key outside of its [notBefore, expiresAt) window with a terminal error
+func (k *apiKey) checkValidity(now time.Time) error {
+	if !k.notBefore.IsZero() && now.Before(k.notBefore) {
+		return newTerminalError(withReason(reasonNotYetValid, serviceerror.NewPermissionDenied("api key not yet valid", "")))
+	}
+	if !k.expiresAt.IsZero() && !now.Before(k.expiresAt) {
+		return newTerminalError(withReason(reasonExpired, serviceerror.NewPermissionDenied("api key expired", "")))
+	}
+	return nil
+}
+
+// parseAPIKeysString parses "<key>:<role>:<namespace>[,<role>:<namespace>...];..." where <key> is either
+// a plaintext key or a hashed one "<keyID>$<scheme>$..." (see parseSecretHash).
+// Entries of the same key are merged into one claims, conflicting roles are reported as an error.
+func parseAPIKeysString(apiKeysStr string) (map[string]*apiKey, error) {
+	keys := make(map[string]*apiKey)
 	for _, entry := range strings.Split(apiKeysStr, ";") {
 		entry = strings.TrimSpace(entry)
 		if entry == "" {
 			continue
 		}
-		parts := strings.Split(strings.TrimSpace(entry), ":")
-		if len(parts) != 3 {
+		keySpec, grants, ok := strings.Cut(entry, ":")
+		if !ok {
 			return keys, fmt.Errorf("invalid key [%.*s...] format - expected <key>:<role>:<namespace>", 3, entry)
 		}
-		if parts[0] == "" || parts[1] == "" || parts[2] == "" {
-			return keys, fmt.Errorf("invalid key format: [<key>(len:%d):<role>(val:%s):<namespace>(val:%s)]", len(parts[0]), parts[1], parts[2])
-		}
-
-		apiKey := parts[0]
-		role := permissionToRole(parts[1])
-		namespace := parts[2]
-		claim := &authorization.Claims{
-			Subject:    apiKey,
-			Namespaces: map[string]authorization.Role{},
+		id, verifier, hashed, err := parseKeySpec(keySpec)
+		if err != nil {
+			return keys, err
 		}
-		if namespace == "*" {
-			claim.System = role
-		} else {
-			claim.Namespaces[namespace] = role
+		key, ok := keys[id]
+		if !ok {
+			key = &apiKey{id: id, hashed: hashed, verifier: verifier, claims: &authorization.Claims{
+				Subject:    id,
+				Namespaces: map[string]authorization.Role{},
+			}}
+			keys[id] = key
+		} else if key.hashed != hashed || !reflect.DeepEqual(key.verifier, verifier) {
+			return keys, fmt.Errorf("key %q: defined more than once with different secrets", id)
 		}
 
-		keys[apiKey] = claim
+		for _, grant := range strings.Split(grants, ",") {
+			parts := strings.Split(strings.TrimSpace(grant), ":")
+			if len(parts) != 2 {
+				return keys, fmt.Errorf("invalid key [%.*s...] format - expected <key>:<role>:<namespace>", 3, entry)
+			}
+			if keySpec == "" || parts[0] == "" || parts[1] == "" {
+				return keys, fmt.Errorf("invalid key format: [<key>(len:%d):<role>(val:%s):<namespace>(val:%s)]", len(keySpec), parts[0], parts[1])
+			}
+			namespace := parts[1]
+			if namespace == namespaceSystemDeprecated {
+				key.deprecatedSystemGrant = true
+				namespace = namespaceSystem
+			}
+			role, err := parseRole(parts[0])
+			if err != nil {
+				return keys, fmt.Errorf("key %q: %w", id, err)
+			}
+			if err := addGrant(key.claims, role, namespace); err != nil {
+				return keys, fmt.Errorf("key %q: %w", id, err)
+			}
+		}
 	}
 
 	return keys, nil
 }
+
+// addGrant adds a role on namespace ("@system" for system) to claims, a different role on the same scope is a conflict.
+// Namespace globs, "/regexp/" and "@all" are added as namespace patterns to the claims extensions.
+func addGrant(claims *authorization.Claims, role authorization.Role, namespace string) error {
+	if namespace == namespaceSystem {
+		if claims.System != authorization.RoleUndefined && claims.System != role {
+			return fmt.Errorf("conflicting system roles %s and %s", roleToPermission(claims.System), roleToPermission(role))
+		}
+		claims.System = role
+		return nil
+	}
+	pattern, err := parseNamespacePattern(namespace, role)
+	if err != nil {
+		return err
+	}
+	if pattern != nil {
+		ext := extensionsOf(claims)
+		for _, p := range ext.NamespacePatterns {
+			if p.Pattern == namespace && p.Role != role {
+				return fmt.Errorf("conflicting roles %s and %s on namespace pattern %q", roleToPermission(p.Role), roleToPermission(role), namespace)
+			}
+			if p.Pattern == namespace {
+				return nil
+			}
+		}
+		ext.NamespacePatterns = append(ext.NamespacePatterns, *pattern)
+		return nil
+	}
+	if current, ok := claims.Namespaces[namespace]; ok && current != role {
+		return fmt.Errorf("conflicting roles %s and %s on namespace %q", roleToPermission(current), roleToPermission(role), namespace)
+	}
+	claims.Namespaces[namespace] = role
+	return nil
+}
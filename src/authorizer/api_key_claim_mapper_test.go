@@ -1,6 +1,8 @@
 package authorizer
 
 import (
+	"crypto/sha256"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,36 +11,138 @@ import (
 	"go.temporal.io/server/common/log"
 )
 
-func TestPermissionToRole(t *testing.T) {
-	assert.Equal(t, authorization.RoleReader, permissionToRole("read"))
-	assert.Equal(t, authorization.RoleReader, permissionToRole("READ"))
-	assert.Equal(t, authorization.RoleWriter, permissionToRole("write"))
-	assert.Equal(t, authorization.RoleWorker, permissionToRole("worker"))
-	assert.Equal(t, authorization.RoleAdmin, permissionToRole("admin"))
-	assert.Equal(t, authorization.RoleUndefined, permissionToRole("unknown"))
+func plaintextID(key string) string {
+	return plaintextKeyID(plaintextKeyMAC(key))
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		permission string
+		role       authorization.Role
+	}{
+		{"read", authorization.RoleReader},
+		{"READ", authorization.RoleReader},
+		{"reader", authorization.RoleReader},
+		{"ro", authorization.RoleReader},
+		{"write", authorization.RoleWriter},
+		{"Writer", authorization.RoleWriter},
+		{"rw", authorization.RoleWriter},
+		{"worker", authorization.RoleWorker},
+		{"admin", authorization.RoleAdmin},
+		{"read+worker", authorization.RoleReader | authorization.RoleWorker},
+		{"worker + rw", authorization.RoleWorker | authorization.RoleWriter},
+		{"read+read", authorization.RoleReader},
+		{"worker+read+write+admin", authorization.RoleWorker | authorization.RoleReader | authorization.RoleWriter | authorization.RoleAdmin},
+	}
+	for _, tc := range tests {
+		t.Run(tc.permission, func(t *testing.T) {
+			role, err := parseRole(tc.permission)
+			require.NoError(t, err)
+			assert.Equal(t, tc.role, role)
+		})
+	}
+
+	for _, permission := range []string{"", "unknown", "writes", "read+", "+read", "read,worker", "read+unknown", "*"} {
+		t.Run("invalid "+permission, func(t *testing.T) {
+			role, err := parseRole(permission)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "unknown role")
+			assert.Equal(t, authorization.RoleUndefined, role)
+		})
+	}
 }
 
 func TestParseApiKeysString_Success(t *testing.T) {
-	keys, err := parseAPIKeysString("app1:write:ns1; admin:*:should-not-parse; admin:admin:* ; worker:worker:ns2 ;  ")
+	keys, err := parseAPIKeysString("app1:write:ns1; admin:admin:* ; worker:worker:ns2 ;  ")
 	require.NoError(t, err)
 
 	// app1 key -> namespace role
-	c1 := keys["app1"]
-	require.NotNil(t, c1)
-	assert.Equal(t, "app1", c1.Subject)
+	k1 := keys[plaintextID("app1")]
+	require.NotNil(t, k1)
+	c1 := k1.claims
+	assert.Equal(t, plaintextID("app1"), c1.Subject)
 	assert.Equal(t, authorization.RoleWriter, c1.Namespaces["ns1"])
 	assert.Equal(t, authorization.RoleUndefined, c1.System)
 
 	// admin key -> system role
-	c2 := keys["admin"]
-	require.NotNil(t, c2)
+	k2 := keys[plaintextID("admin")]
+	require.NotNil(t, k2)
+	c2 := k2.claims
 	assert.Equal(t, authorization.RoleAdmin, c2.System)
 	assert.Empty(t, c2.Namespaces)
 
 	// worker key -> namespace role
-	c3 := keys["worker"]
-	require.NotNil(t, c3)
-	assert.Equal(t, authorization.RoleWorker, c3.Namespaces["ns2"])
+	k3 := keys[plaintextID("worker")]
+	require.NotNil(t, k3)
+	assert.Equal(t, authorization.RoleWorker, k3.claims.Namespaces["ns2"])
+}
+
+func TestParseApiKeysString_RoleAliases(t *testing.T) {
+	keys, err := parseAPIKeysString("app1-key:writer:app1-namespace;bot:read+worker:orders,ro:billing;ops:rw:@system")
+	require.NoError(t, err)
+
+	assert.Equal(t, authorization.RoleWriter, keys[plaintextID("app1-key")].claims.Namespaces["app1-namespace"])
+	assert.Equal(t, map[string]authorization.Role{
+		"orders":  authorization.RoleReader | authorization.RoleWorker,
+		"billing": authorization.RoleReader,
+	}, keys[plaintextID("bot")].claims.Namespaces)
+	assert.Equal(t, authorization.RoleWriter, keys[plaintextID("ops")].claims.System)
+}
+
+func TestParseApiKeysString_Merge(t *testing.T) {
+	keys, err := parseAPIKeysString("ci:write:orders;ci:read:billing;ci:write:orders;ci:admin:*;multi:write:orders,read:billing")
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	c := keys[plaintextID("ci")].claims
+	assert.Equal(t, map[string]authorization.Role{
+		"orders":  authorization.RoleWriter,
+		"billing": authorization.RoleReader,
+	}, c.Namespaces)
+	assert.Equal(t, authorization.RoleAdmin, c.System)
+
+	multi := keys[plaintextID("multi")].claims
+	assert.Equal(t, c.Namespaces, multi.Namespaces)
+	assert.Equal(t, authorization.RoleUndefined, multi.System)
+}
+
+func TestParseApiKeysString_Conflicts(t *testing.T) {
+	hash := "ci-bot$" + sha256Hash("salt", "s3cret")
+	for _, keysStr := range []string{
+		"ci:write:orders;ci:read:orders",
+		"ci:write:orders,read:orders",
+		"ci:admin:*;ci:read:*",
+		"ci:admin:*;ci:read:@system",
+		hash + ":write:orders;ci-bot$" + sha256Hash("salt2", "s3cret") + ":read:billing",
+	} {
+		_, err := parseAPIKeysString(keysStr)
+		assert.Error(t, err, keysStr)
+	}
+
+	keys, err := parseAPIKeysString(hash + ":write:orders;" + hash + ":read:billing")
+	require.NoError(t, err)
+	assert.Len(t, keys["ci-bot"].claims.Namespaces, 2)
+}
+
+func TestParseApiKeysString_SystemGrant(t *testing.T) {
+	keys, err := parseAPIKeysString("ops:admin:@system;legacy:read:*;all:read:@all;both:read:@system,read:*")
+	require.NoError(t, err)
+
+	ops := keys[plaintextID("ops")]
+	assert.Equal(t, authorization.RoleAdmin, ops.claims.System)
+	assert.False(t, ops.deprecatedSystemGrant)
+
+	legacy := keys[plaintextID("legacy")]
+	assert.Equal(t, authorization.RoleReader, legacy.claims.System, "* stays a system grant")
+	assert.True(t, legacy.deprecatedSystemGrant)
+
+	all := keys[plaintextID("all")]
+	assert.Equal(t, authorization.RoleUndefined, all.claims.System)
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(all.claims, "orders"))
+
+	both := keys[plaintextID("both")]
+	assert.Equal(t, authorization.RoleReader, both.claims.System)
+	assert.True(t, both.deprecatedSystemGrant)
 }
 
 func TestParseApiKeysString_Invalid(t *testing.T) {
@@ -46,6 +150,10 @@ func TestParseApiKeysString_Invalid(t *testing.T) {
 	_, err := parseAPIKeysString("bad:format")
 	require.Error(t, err)
 
+	// unknown role, e.g. a typo, fails instead of creating a key without permissions
+	_, err = parseAPIKeysString("app1-key:wrtie:app1-namespace")
+	require.ErrorContains(t, err, `unknown role "wrtie"`)
+
 	// empty sections are skipped, but malformed entries error
 	_, err = parseAPIKeysString("ok:read:ns; badentry")
 	require.Error(t, err)
@@ -62,13 +170,13 @@ func TestAPIKeyClaimMapper_GetClaims_TokenVariants(t *testing.T) {
 		expectSubject string
 		validate      func(*testing.T, *authorization.Claims)
 	}{
-		{"bearer lower", "bearer valid", "valid", func(t *testing.T, c *authorization.Claims) {
+		{"bearer lower", "bearer valid", plaintextID("valid"), func(t *testing.T, c *authorization.Claims) {
 			assert.Equal(t, authorization.RoleWriter, c.Namespaces["ns"])
 		}},
-		{"bearer upper", "Bearer valid", "valid", func(t *testing.T, c *authorization.Claims) {
+		{"bearer upper", "Bearer valid", plaintextID("valid"), func(t *testing.T, c *authorization.Claims) {
 			assert.Equal(t, authorization.RoleWriter, c.Namespaces["ns"])
 		}},
-		{"admin wildcard", "Bearer admin", "admin", func(t *testing.T, c *authorization.Claims) {
+		{"admin wildcard", "Bearer admin", plaintextID("admin"), func(t *testing.T, c *authorization.Claims) {
 			assert.Equal(t, authorization.RoleAdmin, c.System)
 		}},
 	}
@@ -111,3 +219,158 @@ func TestAPIKeyClaimMapper_GetClaims_Nones(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, claims)
 }
+
+func TestParseApiKeysString_Hashed(t *testing.T) {
+	keys, err := parseAPIKeysString("ci-bot$" + sha256Hash("salt", "s3cret") + ":write:orders")
+	require.NoError(t, err)
+
+	k := keys["ci-bot"]
+	require.NotNil(t, k)
+	assert.True(t, k.hashed)
+	assert.Equal(t, "ci-bot", k.claims.Subject)
+	assert.Equal(t, authorization.RoleWriter, k.claims.Namespaces["orders"])
+
+	// not a supported scheme, so a plaintext key
+	keys, err = parseAPIKeysString("ci-bot$md5$abc:write:orders")
+	require.NoError(t, err)
+	require.Contains(t, keys, plaintextID("ci-bot$md5$abc"))
+	assert.False(t, keys[plaintextID("ci-bot$md5$abc")].hashed)
+	_, err = parseAPIKeysString("ci bot$" + sha256Hash("salt", "s3cret") + ":write:orders")
+	require.Error(t, err)
+}
+
+func TestAPIKeyClaimMapper_GetClaims_Hashed(t *testing.T) {
+	logger := log.NewTestLogger()
+	mapper, err := NewAPIKeyClaimMapper("ci-bot$"+sha256Hash("salt", "s3cret")+":write:orders", logger)
+	require.NoError(t, err)
+
+	claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.s3cret"})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+	assert.Equal(t, "ci-bot", claims.Subject)
+	assert.Equal(t, authorization.RoleWriter, claims.Namespaces["orders"])
+
+	// wrong secret for a known key ID
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.wrong"})
+	require.Error(t, err)
+	assert.Nil(t, claims)
+
+	// the hash itself is not a valid key
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot$" + sha256Hash("salt", "s3cret")})
+	require.NoError(t, err)
+	assert.Nil(t, claims)
+}
+
+// countingVerifier counts the secrets it hashes
+type countingVerifier struct {
+	secretVerifier
+	calls int
+}
+
+func (v *countingVerifier) verify(secret string) bool {
+	v.calls++
+	return v.secretVerifier.verify(secret)
+}
+
+func TestAPIKeyClaimMapper_GetClaims_VerifiedCache(t *testing.T) {
+	mapper, err := newAPIKeyClaimMapper(func() (*apiKeySet, error) {
+		keys, err := parseAPIKeysString("ci-bot$" + sha256Hash("salt", "s3cret") + ":write:orders")
+		return &apiKeySet{keys: keys}, err
+	}, log.NewTestLogger())
+	require.NoError(t, err)
+	verifier := &countingVerifier{secretVerifier: mapper.set.Load().keys["ci-bot"].verifier}
+	mapper.set.Load().keys["ci-bot"].verifier = verifier
+
+	for range 3 {
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.s3cret"})
+		require.NoError(t, err)
+		assert.Equal(t, "ci-bot", claims.Subject)
+	}
+	assert.Equal(t, 1, verifier.calls, "a verified token is not hashed again")
+
+	// rejected secrets are never cached
+	for range 2 {
+		_, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.wrong"})
+		require.EqualError(t, err, "invalid api key")
+	}
+	assert.Equal(t, 3, verifier.calls)
+}
+
+func TestAPIKeyClaimMapper_GetClaims_StructuredKey(t *testing.T) {
+	secret := strings.Repeat("s3cret", 5) + "ab"
+	token := formatAPIKeyToken("ci_bot", secret)
+	mapper, err := NewAPIKeyClaimMapper("ci_bot$"+sha256Hash("salt", secret)+":write:orders", log.NewTestLogger())
+	require.NoError(t, err)
+
+	claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + token})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+	assert.Equal(t, "ci_bot", claims.Subject)
+	assert.Equal(t, authorization.RoleWriter, claims.Namespaces["orders"])
+
+	// the same key presented as "<keyID>.<secret>"
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci_bot." + secret})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+
+	// a typo is rejected by the checksum before any lookup, no other claim mapper gets to accept it
+	typo := strings.Replace(token, "s3cret", "s3crat", 1)
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + typo})
+	require.Error(t, err)
+	assert.True(t, isTerminalError(err))
+	assert.Contains(t, err.Error(), "checksum")
+	assert.Nil(t, claims)
+
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer tmprl_garbage"})
+	require.Error(t, err)
+	assert.True(t, isTerminalError(err))
+	assert.Contains(t, err.Error(), "malformed")
+	assert.Nil(t, claims)
+
+	// a valid checksum with a wrong secret
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + formatAPIKeyToken("ci_bot", strings.Repeat("x", apiKeySecretLength))})
+	require.Error(t, err)
+	assert.False(t, isTerminalError(err))
+	assert.Contains(t, err.Error(), "invalid api key")
+	assert.Nil(t, claims)
+}
+
+const timingKey = "k3y-0123456789abcdef0123456789abcdef0123456789abcdef0123456789ab"
+
+func BenchmarkAPIKeyClaimMapper_GetClaims(b *testing.B) {
+	mapper, err := NewAPIKeyClaimMapper(timingKey+":write:ns;ci-bot$"+sha256Hash("salt", "s3cret")+":write:ns", log.NewNoopLogger())
+	require.NoError(b, err)
+
+	for _, bc := range []struct{ name, token string }{
+		{"plaintext", timingKey},
+		{"plaintext miss", strings.Repeat("x", len(timingKey))},
+		{"hashed", "ci-bot.s3cret"},
+		{"hashed miss", "ci-bot.wrong"},
+	} {
+		authInfo := &authorization.AuthInfo{AuthToken: "Bearer " + bc.token}
+		b.Run(bc.name, func(b *testing.B) {
+			for b.Loop() {
+				_, _ = mapper.GetClaims(authInfo)
+			}
+		})
+	}
+}
+
+// TestAPIKeySet_PlaintextIndex guards against a lookup whose timing depends on how much of a key was guessed right:
+// plaintext keys are only indexed by their peppered MAC, never by the raw key or an unkeyed digest of it
+func TestAPIKeySet_PlaintextIndex(t *testing.T) {
+	otherKey := strings.Repeat("x", len(timingKey))
+	keys, err := parseAPIKeysString(timingKey + ":write:ns;" + otherKey + ":read:ns;ci-bot$" + sha256Hash("salt", "s3cret") + ":write:ns")
+	require.NoError(t, err)
+	set := &apiKeySet{keys: keys}
+	set.index()
+
+	require.Len(t, set.plaintext, 2, "hashed keys are not in the plaintext index")
+	for _, raw := range []string{timingKey, otherKey} {
+		key, ok := set.plaintext[plaintextKeyMAC(raw)]
+		require.True(t, ok, raw)
+		assert.Equal(t, plaintextID(raw), key.id)
+		assert.NotContains(t, set.plaintext, sha256.Sum256([]byte(raw)))
+		assert.NotContains(t, set.keys, raw)
+	}
+}
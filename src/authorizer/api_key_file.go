@@ -0,0 +1,207 @@
+package authorizer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// apiKeysDocument is the API key registry file (YAML or JSON), see schema/api-keys.schema.json
+	apiKeysDocument struct {
+		// DefaultRateLimit applies to keys without a rateLimit of their own
+		DefaultRateLimit *RateLimit             `yaml:"defaultRateLimit"`
+		Keys             []apiKeyDefinition     `yaml:"keys"`
+		Revoked          []revocationDefinition `yaml:"revoked"`
+	}
+
+	apiKeyDefinition struct {
+		ID          string            `yaml:"id"`
+		Description string            `yaml:"description"`
+		Owner       string            `yaml:"owner"`
+		SecretHash  string            `yaml:"secretHash"`
+		Namespaces  map[string]string `yaml:"namespaces"`
+		SystemRole  string            `yaml:"systemRole"`
+		Metadata    map[string]string `yaml:"metadata"`
+		NotBefore   time.Time         `yaml:"notBefore"`
+		ExpiresAt   time.Time         `yaml:"expiresAt"`
+		RateLimit   *RateLimit        `yaml:"rateLimit"`
+	}
+
+	// revocationDefinition names a revoked key by its ID or by the sha256 hex digest of the whole presented token
+	revocationDefinition struct {
+		ID        string    `yaml:"id"`
+		SHA256    string    `yaml:"sha256"`
+		Reason    string    `yaml:"reason"`
+		RevokedAt time.Time `yaml:"revokedAt"`
+	}
+)
+
+// NewAPIKeyFileClaimMapper creates a new apiKeyClaimMapper with keys loaded from a YAML/JSON registry file.
+func NewAPIKeyFileClaimMapper(path string, logger logpkg.Logger) (authorization.ClaimMapper, error) {
+	m, err := newAPIKeyClaimMapper(func() (*apiKeySet, error) { return parseAPIKeysFile(path) }, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("API key file claim-mapper initialized")
+	return m, nil
+}
+
+// ShareAPIKeyRevocations makes keys (TEMPORAL_API_KEYS) reject the keys revoked in the registry file of
+// fileKeys too, the revoked list is read again on every reload of the file
+func ShareAPIKeyRevocations(keys, fileKeys authorization.ClaimMapper) error {
+	m, ok := keys.(*apiKeyClaimMapper)
+	if !ok {
+		return fmt.Errorf("not an api key claim-mapper: %T", keys)
+	}
+	file, ok := fileKeys.(*apiKeyClaimMapper)
+	if !ok {
+		return fmt.Errorf("not an api key file claim-mapper: %T", fileKeys)
+	}
+	m.revocations = file
+	return nil
+}
+
+func parseAPIKeysFile(path string) (*apiKeySet, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("api keys file: %w", err)
+	}
+	set, err := parseAPIKeysDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("api keys file %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// parseAPIKeysDocument parses and validates the registry, YAML being a superset of JSON covers both formats
+func parseAPIKeysDocument(data []byte) (*apiKeySet, error) {
+	var doc apiKeysDocument
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if doc.DefaultRateLimit != nil {
+		if err := doc.DefaultRateLimit.validate(); err != nil {
+			return nil, fmt.Errorf("defaultRateLimit.%w", err)
+		}
+	}
+	keys := make(map[string]*apiKey, len(doc.Keys))
+	for i := range doc.Keys {
+		key, err := doc.Keys[i].toAPIKey(doc.DefaultRateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d] (id %q): %w", i, doc.Keys[i].ID, err)
+		}
+		if _, ok := keys[key.id]; ok {
+			return nil, fmt.Errorf("keys[%d] (id %q): id: duplicate key id", i, key.id)
+		}
+		keys[key.id] = key
+	}
+
+	revoked := make(map[string]revocation, len(doc.Revoked))
+	for i, r := range doc.Revoked {
+		id, err := r.revokedID()
+		if err != nil {
+			return nil, fmt.Errorf("revoked[%d]: %w", i, err)
+		}
+		revoked[id] = revocation{reason: r.Reason, revokedAt: r.RevokedAt}
+	}
+	return &apiKeySet{keys: keys, revoked: revoked}, nil
+}
+
+func (r *revocationDefinition) revokedID() (string, error) {
+	switch {
+	case r.ID != "" && r.SHA256 != "":
+		return "", fmt.Errorf("id, sha256: only one of them is allowed")
+	case r.ID != "":
+		if !keyIDPattern.MatchString(r.ID) {
+			return "", fmt.Errorf("id: expected [A-Za-z0-9_-]+")
+		}
+		return r.ID, nil
+	case r.SHA256 != "":
+		digest, err := hex.DecodeString(r.SHA256)
+		if err != nil || len(digest) != sha256.Size {
+			return "", fmt.Errorf("sha256: expected hex encoded sha256 digest")
+		}
+		return revokedDigestPrefix + strings.ToLower(r.SHA256), nil
+	}
+	return "", fmt.Errorf("id: one of id or sha256 is required")
+}
+
+func (d *apiKeyDefinition) toAPIKey(defaultRateLimit *RateLimit) (*apiKey, error) {
+	if !keyIDPattern.MatchString(d.ID) {
+		return nil, fmt.Errorf("id: expected [A-Za-z0-9_-]+")
+	}
+	if d.SecretHash == "" {
+		return nil, fmt.Errorf("secretHash: required")
+	}
+	verifier, err := parseSecretHash(d.SecretHash)
+	if err != nil {
+		return nil, fmt.Errorf("secretHash: %w", err)
+	}
+
+	claims := &authorization.Claims{Subject: d.ID, Namespaces: make(map[string]authorization.Role, len(d.Namespaces))}
+	if d.SystemRole != "" {
+		if claims.System, err = parseRole(d.SystemRole); err != nil {
+			return nil, fmt.Errorf("systemRole: %w", err)
+		}
+	}
+	for namespace, permission := range d.Namespaces {
+		if namespace == "" {
+			return nil, fmt.Errorf("namespaces.%q: invalid namespace", namespace)
+		}
+		// "*" is the system role in TEMPORAL_API_KEYS, moving a key from the file there must not change its grants
+		if namespace == namespaceSystemDeprecated {
+			return nil, fmt.Errorf("namespaces.%s: %w", namespace, errAmbiguousNamespace)
+		}
+		role, err := parseRole(permission)
+		if err != nil {
+			return nil, fmt.Errorf("namespaces.%s: %w", namespace, err)
+		}
+		if err := addGrant(claims, role, namespace); err != nil {
+			return nil, fmt.Errorf("namespaces.%s: %w", namespace, err)
+		}
+	}
+	if !hasClaims(claims) {
+		return nil, fmt.Errorf("namespaces: at least one namespace or systemRole is required")
+	}
+	if !d.NotBefore.IsZero() && !d.ExpiresAt.IsZero() && !d.ExpiresAt.After(d.NotBefore) {
+		return nil, fmt.Errorf("expiresAt: must be after notBefore")
+	}
+	rateLimit := defaultRateLimit
+	if d.RateLimit != nil {
+		if err := d.RateLimit.validate(); err != nil {
+			return nil, fmt.Errorf("rateLimit.%w", err)
+		}
+		rateLimit = d.RateLimit
+	}
+	if rateLimit != nil {
+		// rps 0 is kept, it exempts the key from the subject rate limit
+		extensionsOf(claims).RateLimit = rateLimit
+	}
+
+	return &apiKey{
+		id:          d.ID,
+		hashed:      true,
+		verifier:    verifier,
+		claims:      claims,
+		description: d.Description,
+		owner:       d.Owner,
+		metadata:    d.Metadata,
+		notBefore:   d.NotBefore,
+		expiresAt:   d.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,351 @@
+package authorizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+)
+
+func TestParseAPIKeysDocument_YAML(t *testing.T) {
+	set, err := parseAPIKeysDocument([]byte(`
+keys:
+  - id: ci-bot
+    description: CI pipeline
+    owner: platform-team
+    secretHash: "$` + sha256Hash("salt", "s3cret") + `"
+    namespaces:
+      "orders:eu": write
+      billing: read
+    metadata:
+      ticket: OPS-1
+  - id: ops
+    secretHash: "$` + sha256Hash("salt", "0ps") + `"
+    systemRole: admin
+`))
+	require.NoError(t, err)
+	require.Len(t, set.keys, 2)
+
+	ci := set.keys["ci-bot"]
+	require.NotNil(t, ci)
+	assert.Equal(t, "ci-bot", ci.claims.Subject)
+	assert.Equal(t, map[string]authorization.Role{
+		"orders:eu": authorization.RoleWriter,
+		"billing":   authorization.RoleReader,
+	}, ci.claims.Namespaces)
+	assert.Equal(t, "platform-team", ci.owner)
+	assert.Equal(t, "OPS-1", ci.metadata["ticket"])
+	assert.True(t, ci.verifier.verify("s3cret"))
+
+	assert.Equal(t, authorization.RoleAdmin, set.keys["ops"].claims.System)
+}
+
+func TestParseAPIKeysDocument_JSON(t *testing.T) {
+	set, err := parseAPIKeysDocument([]byte(`{"keys": [
+		{"id": "ci-bot", "secretHash": "$` + sha256Hash("salt", "s3cret") + `", "namespaces": {"orders": "write"}}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, authorization.RoleWriter, set.keys["ci-bot"].claims.Namespaces["orders"])
+}
+
+func TestParseAPIKeysDocument_Invalid(t *testing.T) {
+	hash := "$" + sha256Hash("salt", "s3cret")
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"unknown field", `{"keys": [{"id": "a", "secret": "x"}]}`, "field secret not found"},
+		{"bad id", `{"keys": [{"id": "a b", "secretHash": "` + hash + `", "systemRole": "read"}]}`, `keys[0] (id "a b"): id:`},
+		{"no hash", `{"keys": [{"id": "a", "systemRole": "read"}]}`, `keys[0] (id "a"): secretHash: required`},
+		{"bad hash", `{"keys": [{"id": "a", "secretHash": "plain", "systemRole": "read"}]}`, `keys[0] (id "a"): secretHash:`},
+		{"bad role", `{"keys": [{"id": "a", "secretHash": "` + hash + `", "namespaces": {"ns": "wrtie"}}]}`,
+			`keys[0] (id "a"): namespaces.ns: unknown role "wrtie"`},
+		{"bad system role", `{"keys": [{"id": "a", "secretHash": "` + hash + `", "systemRole": "root"}]}`,
+			`keys[0] (id "a"): systemRole: unknown role "root"`},
+		{"bad namespace regexp", `{"keys": [{"id": "a", "secretHash": "` + hash + `", "namespaces": {"/team-(/": "read"}}]}`,
+			`keys[0] (id "a"): namespaces./team-(/: invalid namespace regexp`},
+		{"bare wildcard", `{"keys": [{"id": "a", "secretHash": "` + hash + `", "namespaces": {"*": "read"}}]}`,
+			`keys[0] (id "a"): namespaces.*: ambiguous, use "@all" for every namespace or "@system" for a system role`},
+		{"bad rate limit", `{"keys": [{"id": "a", "secretHash": "` + hash + `", "systemRole": "read", "rateLimit": {"rps": 1, "burst": -1}}]}`,
+			`keys[0] (id "a"): rateLimit.burst:`},
+		{"bad default rate limit", `{"defaultRateLimit": {"rps": -1}, "keys": []}`, `defaultRateLimit.rps:`},
+		{"no grants", `{"keys": [{"id": "a", "secretHash": "` + hash + `"}]}`, `keys[0] (id "a"): namespaces: at least one`},
+		{"duplicate", `{"keys": [{"id": "a", "secretHash": "` + hash + `", "systemRole": "read"},
+			{"id": "a", "secretHash": "` + hash + `", "systemRole": "read"}]}`, `keys[1] (id "a"): id: duplicate`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseAPIKeysDocument([]byte(tc.doc))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestNewAPIKeyFileClaimMapper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+keys:
+  - id: ci-bot
+    secretHash: "$`+sha256Hash("salt", "s3cret")+`"
+    namespaces: {orders: write}
+`), 0o600))
+
+	mapper, err := NewAPIKeyFileClaimMapper(path, log.NewTestLogger())
+	require.NoError(t, err)
+	claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.s3cret"})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+	assert.Equal(t, "ci-bot", claims.Subject)
+
+	_, err = NewAPIKeyFileClaimMapper(filepath.Join(t.TempDir(), "missing.yaml"), log.NewTestLogger())
+	require.Error(t, err)
+}
+
+func TestParseAPIKeysDocument_Validity(t *testing.T) {
+	hash := "$" + sha256Hash("salt", "s3cret")
+	set, err := parseAPIKeysDocument([]byte(`
+keys:
+  - id: contractor
+    secretHash: "` + hash + `"
+    systemRole: read
+    notBefore: 2026-01-01T00:00:00Z
+    expiresAt: "2026-02-01T00:00:00Z"
+`))
+	require.NoError(t, err)
+	k := set.keys["contractor"]
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), k.notBefore)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), k.expiresAt)
+
+	_, err = parseAPIKeysDocument([]byte(`
+keys:
+  - id: contractor
+    secretHash: "` + hash + `"
+    systemRole: read
+    notBefore: 2026-02-01T00:00:00Z
+    expiresAt: 2026-01-01T00:00:00Z
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `keys[0] (id "contractor"): expiresAt:`)
+
+	_, err = parseAPIKeysDocument([]byte(`{"keys": [{"id": "a", "secretHash": "` + hash + `", "systemRole": "read", "expiresAt": "tomorrow"}]}`))
+	require.Error(t, err)
+}
+
+func TestAPIKeyClaimMapper_GetClaims_Validity(t *testing.T) {
+	hash := "$" + sha256Hash("salt", "s3cret")
+	mapper, err := newAPIKeyClaimMapper(func() (*apiKeySet, error) {
+		return parseAPIKeysDocument([]byte(`
+keys:
+  - id: contractor
+    secretHash: "` + hash + `"
+    systemRole: read
+    notBefore: 2026-01-01T00:00:00Z
+    expiresAt: 2026-02-01T00:00:00Z
+`))
+	}, log.NewTestLogger())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		err  string
+	}{
+		{"not yet valid", time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC), "api key not yet valid"},
+		{"valid from", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"valid", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), ""},
+		{"expired", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), "api key expired"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mapper.now = func() time.Time { return tc.now }
+			claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer contractor.s3cret"})
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.NotNil(t, claims)
+				return
+			}
+			var permissionDenied *serviceerror.PermissionDenied
+			require.ErrorAs(t, err, &permissionDenied)
+			assert.Equal(t, tc.err, permissionDenied.Message)
+			assert.True(t, isTerminalError(err))
+			assert.Nil(t, claims)
+
+			// no later claim mapper gets to accept the key, the reason reaches the client
+			m := NewMultiClaimMapper(log.NewTestLogger())
+			m.Add("apiKeyFileClaimMapper", mapper)
+			m.Add("fallback", fakeMapper{claims: &authorization.Claims{Subject: "fallback", System: authorization.RoleAdmin}})
+			claims, err = m.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer contractor.s3cret"})
+			require.EqualError(t, err, tc.err)
+			assert.Nil(t, claims)
+		})
+	}
+
+	// a wrong secret is not told apart by validity
+	mapper.now = func() time.Time { return time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC) }
+	_, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer contractor.wrong"})
+	require.EqualError(t, err, "invalid api key")
+}
+
+func TestParseAPIKeysDocument_Revoked(t *testing.T) {
+	digest := sha256.Sum256([]byte("leaked-plaintext"))
+	set, err := parseAPIKeysDocument([]byte(`
+revoked:
+  - id: ci-bot
+    reason: leaked in a build log
+    revokedAt: 2026-03-01T10:00:00Z
+  - sha256: ` + strings.ToUpper(hex.EncodeToString(digest[:])) + `
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "leaked in a build log", set.revoked["ci-bot"].reason)
+	assert.Contains(t, set.revoked, "sha256:"+hex.EncodeToString(digest[:]))
+
+	for _, doc := range []string{
+		`{"revoked": [{"reason": "x"}]}`,
+		`{"revoked": [{"id": "a", "sha256": "` + hex.EncodeToString(digest[:]) + `"}]}`,
+		`{"revoked": [{"sha256": "abcd"}]}`,
+		`{"revoked": [{"id": "a b"}]}`,
+	} {
+		_, err := parseAPIKeysDocument([]byte(doc))
+		require.Error(t, err, doc)
+		assert.Contains(t, err.Error(), "revoked[0]")
+	}
+}
+
+func TestAPIKeyClaimMapper_GetClaims_Revoked(t *testing.T) {
+	hash := "$" + sha256Hash("salt", "s3cret")
+	plainDigest := sha256.Sum256([]byte("plain-key"))
+	tokenDigest := sha256.Sum256([]byte("other.s3cret"))
+	set, err := parseAPIKeysDocument([]byte(`
+keys:
+  - {id: ci-bot, secretHash: "` + hash + `", systemRole: read}
+  - {id: other, secretHash: "` + hash + `", systemRole: read}
+  - {id: active, secretHash: "` + hash + `", systemRole: read}
+revoked:
+  - id: ci-bot
+  - sha256: ` + hex.EncodeToString(tokenDigest[:]) + `
+  - sha256: ` + hex.EncodeToString(plainDigest[:]) + `
+`))
+	require.NoError(t, err)
+	plain, err := parseAPIKeysString("plain-key:read:ns")
+	require.NoError(t, err)
+	maps.Copy(set.keys, plain)
+	mapper, err := newAPIKeyClaimMapper(func() (*apiKeySet, error) { return set, nil }, log.NewTestLogger())
+	require.NoError(t, err)
+
+	for _, token := range []string{"ci-bot.s3cret", "ci-bot.wrong", "other.s3cret", "plain-key"} {
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + token})
+		require.EqualError(t, err, "api key revoked", token)
+		assert.True(t, isTerminalError(err))
+		assert.Nil(t, claims)
+	}
+
+	claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer active.s3cret"})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+}
+
+func TestShareAPIKeyRevocations(t *testing.T) {
+	logger := log.NewTestLogger()
+	envMapper, err := NewAPIKeyClaimMapper("ci-bot$"+sha256Hash("salt", "s3cret")+":write:orders", logger)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("revoked:\n  - id: ci-bot\n    reason: leaked\n"), 0o600))
+	fileMapper, err := NewAPIKeyFileClaimMapper(path, logger)
+	require.NoError(t, err)
+
+	m := NewMultiClaimMapper(logger)
+	m.Add("apiKeyClaimMapper", envMapper)
+	m.Add("apiKeyFileClaimMapper", fileMapper)
+	authInfo := &authorization.AuthInfo{AuthToken: "Bearer ci-bot.s3cret"}
+	claims, err := m.GetClaims(authInfo)
+	require.NoError(t, err, "without sharing, the env key ignores the revocation in the file")
+	require.NotNil(t, claims)
+
+	require.NoError(t, ShareAPIKeyRevocations(envMapper, fileMapper))
+	claims, err = m.GetClaims(authInfo)
+	require.EqualError(t, err, "api key revoked")
+	assert.Nil(t, claims)
+
+	// the revoked list of the reloaded file applies
+	require.NoError(t, os.WriteFile(path, []byte("revoked: []\n"), 0o600))
+	require.NoError(t, fileMapper.(Reloader).Reload())
+	claims, err = m.GetClaims(authInfo)
+	require.NoError(t, err)
+	assert.Equal(t, "ci-bot", claims.Subject)
+
+	require.Error(t, ShareAPIKeyRevocations(envMapper, fakeMapper{}))
+}
+
+func TestShareAPIKeyRevocations_PlaintextKeyID(t *testing.T) {
+	pepper := apiKeyPepper
+	t.Cleanup(func() { apiKeyPepper = pepper })
+	require.NoError(t, SetAPIKeyPepper("0123456789abcdef"))
+
+	logger := log.NewTestLogger()
+	envMapper, err := NewAPIKeyClaimMapper("pl41n-s3cret:write:orders", logger)
+	require.NoError(t, err)
+	// the ID "apikey list" shows, derived with the same pepper
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("revoked:\n  - id: "+plaintextID("pl41n-s3cret")+"\n"), 0o600))
+	fileMapper, err := NewAPIKeyFileClaimMapper(path, logger)
+	require.NoError(t, err)
+	require.NoError(t, ShareAPIKeyRevocations(envMapper, fileMapper))
+
+	claims, err := envMapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer pl41n-s3cret"})
+	require.EqualError(t, err, "api key revoked")
+	assert.Nil(t, claims)
+}
+
+func TestParseAPIKeysDocument_NamespacePatterns(t *testing.T) {
+	set, err := parseAPIKeysDocument([]byte(`
+keys:
+  - id: team-a
+    secretHash: "$` + sha256Hash("salt", "s3cret") + `"
+    namespaces:
+      team-a-*: write
+      "@all": read
+      shared: read
+  - id: ops
+    secretHash: "$` + sha256Hash("salt", "s3cret") + `"
+    namespaces:
+      "@system": admin
+`))
+	require.NoError(t, err)
+	claims := set.keys["team-a"].claims
+	assert.Equal(t, authorization.RoleUndefined, claims.System)
+	assert.Equal(t, map[string]authorization.Role{"shared": authorization.RoleReader}, claims.Namespaces)
+	assert.Equal(t, authorization.RoleWriter, namespacePatternRole(claims, "team-a-prod"))
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(claims, "team-b-prod"))
+	assert.Equal(t, authorization.RoleAdmin, set.keys["ops"].claims.System)
+}
+
+func TestParseAPIKeysDocument_RateLimit(t *testing.T) {
+	hash := "$" + sha256Hash("salt", "s3cret")
+	set, err := parseAPIKeysDocument([]byte(`
+defaultRateLimit: {rps: 10, burst: 20}
+keys:
+  - {id: default, secretHash: "` + hash + `", systemRole: read}
+  - {id: own, secretHash: "` + hash + `", systemRole: read, rateLimit: {rps: 0.5}}
+  - {id: unlimited, secretHash: "` + hash + `", systemRole: read, rateLimit: {rps: 0}}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, &RateLimit{RPS: 10, Burst: 20}, rateLimitOf(set.keys["default"].claims))
+	assert.Equal(t, &RateLimit{RPS: 0.5}, rateLimitOf(set.keys["own"].claims))
+	assert.Equal(t, &RateLimit{}, rateLimitOf(set.keys["unlimited"].claims))
+
+	set, err = parseAPIKeysDocument([]byte(`{"keys": [{"id": "a", "secretHash": "` + hash + `", "systemRole": "read"}]}`))
+	require.NoError(t, err)
+	assert.Nil(t, rateLimitOf(set.keys["a"].claims))
+}
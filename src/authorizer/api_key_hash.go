@@ -0,0 +1,268 @@
+package authorizer
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	hashSchemeSHA256   = "sha256"
+	hashSchemeArgon2id = "argon2id"
+	hashSchemeBcrypt   = "bcrypt"
+
+	// parameters of generated hashes
+	hashSaltLength    = 16
+	argon2idMemory    = 64 * 1024
+	argon2idTime      = 3
+	argon2idThreads   = 4
+	argon2idKeyLength = 32
+
+	// limits of parsed argon2id hashes, the parameters are used on every request with the key ID and an uncached secret
+	argon2idMaxMemory    = 64 * 1024 // KiB
+	argon2idMaxTime      = 16
+	argon2idMinSaltBytes = 8
+	argon2idMinHashBytes = 16
+
+	// apiKeyIDSeparator splits a presented hashed key "<keyID>.<secret>"
+	apiKeyIDSeparator = "."
+	// plaintextKeyIDPrefix marks key IDs derived from plaintext keys
+	plaintextKeyIDPrefix = "apikey-"
+	// apiKeyPepperMinBytes is the shortest pepper SetAPIKeyPepper accepts
+	apiKeyPepperMinBytes = 16
+	// revokedDigestPrefix marks a revoked "sha256:<hex>" digest of a whole presented token
+	revokedDigestPrefix = "sha256:"
+)
+
+var (
+	keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	// hashedKeySpecPattern is the "<keyID>$<scheme>$" prefix of a hashed key, any other key is plaintext even with a "$"
+	hashedKeySpecPattern = regexp.MustCompile(`^([^$]*)(\$(?:` + hashSchemeSHA256 + `|` + hashSchemeArgon2id + `|2[aby])\$.*)$`)
+)
+
+// apiKeyPepper keys the HMAC plaintext keys are kept, looked up and identified by. It is random per process
+// unless SetAPIKeyPepper configures one, plaintext keys then get the same derived ID across restarts.
+var apiKeyPepper = newPepper()
+
+func newPepper() []byte {
+	pepper := make([]byte, sha256.Size)
+	_, _ = rand.Read(pepper)
+	return pepper
+}
+
+// SetAPIKeyPepper configures the HMAC pepper of plaintext keys, so their derived IDs are stable across restarts
+// and processes. It must be called before any key is parsed.
+func SetAPIKeyPepper(pepper string) error {
+	if len(pepper) < apiKeyPepperMinBytes {
+		return fmt.Errorf("pepper must be at least %d bytes", apiKeyPepperMinBytes)
+	}
+	apiKeyPepper = []byte(pepper)
+	return nil
+}
+
+// secretVerifier checks a presented secret against its stored form
+type secretVerifier interface {
+	verify(secret string) bool
+}
+
+// parseKeySpec turns the key part of a key definition into its ID and verifier.
+// A plaintext key is kept only as its peppered HMAC (see plaintextKeyMAC) and gets an ID derived from it,
+// a hashed key is "<keyID>$<scheme>$..." (PHC string format) with a supported scheme.
+func parseKeySpec(spec string) (id string, verifier secretVerifier, hashed bool, err error) {
+	match := hashedKeySpecPattern.FindStringSubmatch(spec)
+	if match == nil {
+		mac := plaintextKeyMAC(spec)
+		return plaintextKeyID(mac), &hmacVerifier{mac: mac}, false, nil
+	}
+	id, phc := match[1], match[2]
+	if !keyIDPattern.MatchString(id) {
+		return "", nil, true, fmt.Errorf("invalid key ID %q - expected [A-Za-z0-9_-]+", id)
+	}
+	verifier, err = parseSecretHash(phc)
+	if err != nil {
+		return "", nil, true, fmt.Errorf("key %q: %w", id, err)
+	}
+	return id, verifier, true, nil
+}
+
+// parseSecretHash supports:
+//
+//	$sha256$<salt>$<digest>                          sha256(salt + secret), base64 raw std encoding
+//	$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+//	$2a$<cost>$<salt+hash> (also $2b$, $2y$)         bcrypt
+func parseSecretHash(phc string) (secretVerifier, error) {
+	parts := strings.Split(phc, "$")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid hash format")
+	}
+	switch parts[1] {
+	case hashSchemeSHA256:
+		return parseSHA256Hash(parts)
+	case hashSchemeArgon2id:
+		return parseArgon2idHash(parts)
+	case "2a", "2b", "2y":
+		if _, err := bcrypt.Cost([]byte(phc)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+		return &bcryptVerifier{hash: []byte(phc)}, nil
+	}
+	return nil, fmt.Errorf("unsupported hash scheme %q", parts[1])
+}
+
+func parseSHA256Hash(parts []string) (secretVerifier, error) {
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid sha256 hash - expected $sha256$<salt>$<digest>")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid sha256 salt: %w", err)
+	}
+	digest, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256 digest")
+	}
+	return &sha256Verifier{salt: salt, digest: digest}, nil
+}
+
+func parseArgon2idHash(parts []string) (secretVerifier, error) {
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("invalid argon2id hash - expected $argon2id$v=<v>$m=<m>,t=<t>,p=<p>$<salt>$<hash>")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+	v := &argon2idVerifier{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &v.memory, &v.time, &v.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id params %q: %w", parts[3], err)
+	}
+	switch {
+	case v.time < 1 || v.time > argon2idMaxTime:
+		return nil, fmt.Errorf("invalid argon2id params %q: t must be 1 to %d", parts[3], argon2idMaxTime)
+	case v.threads < 1:
+		return nil, fmt.Errorf("invalid argon2id params %q: p must be at least 1", parts[3])
+	case v.memory < 8*uint32(v.threads) || v.memory > argon2idMaxMemory:
+		return nil, fmt.Errorf("invalid argon2id params %q: m must be 8*p to %d KiB", parts[3], argon2idMaxMemory)
+	}
+	var err error
+	if v.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(v.salt) < argon2idMinSaltBytes {
+		return nil, fmt.Errorf("invalid argon2id salt - at least %d bytes expected", argon2idMinSaltBytes)
+	}
+	if v.hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(v.hash) < argon2idMinHashBytes {
+		return nil, fmt.Errorf("invalid argon2id hash - at least %d bytes expected", argon2idMinHashBytes)
+	}
+	return v, nil
+}
+
+// HashAPIKeySecret returns the stored form (PHC string) of secret with a random salt, scheme is
+// sha256, argon2id or bcrypt. Structured key secrets are long and random, so the cheap sha256 is enough for them.
+func HashAPIKeySecret(secret, scheme string) (string, error) {
+	if secret == "" {
+		return "", fmt.Errorf("empty secret")
+	}
+	if scheme == hashSchemeBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return "", fmt.Errorf("bcrypt: %w", err)
+		}
+		return string(hash), nil
+	}
+	salt := make([]byte, hashSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+	b64 := base64.RawStdEncoding.EncodeToString
+	switch scheme {
+	case hashSchemeSHA256:
+		digest := sha256.Sum256(append(salt, secret...))
+		return "$" + hashSchemeSHA256 + "$" + b64(salt) + "$" + b64(digest[:]), nil
+	case hashSchemeArgon2id:
+		hash := argon2.IDKey([]byte(secret), salt, argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLength)
+		return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", hashSchemeArgon2id, argon2.Version,
+			argon2idMemory, argon2idTime, argon2idThreads, b64(salt), b64(hash)), nil
+	}
+	return "", fmt.Errorf("unsupported hash scheme %q - expected %s, %s or %s", scheme, hashSchemeSHA256, hashSchemeArgon2id, hashSchemeBcrypt)
+}
+
+// hashScheme names the scheme a verifier checks secrets with, "plaintext" for plaintext keys
+func hashScheme(v secretVerifier) string {
+	switch v.(type) {
+	case *hmacVerifier:
+		return "plaintext"
+	case *sha256Verifier:
+		return hashSchemeSHA256
+	case *argon2idVerifier:
+		return hashSchemeArgon2id
+	case *bcryptVerifier:
+		return hashSchemeBcrypt
+	}
+	return ""
+}
+
+// plaintextKeyID derives the ID of a plaintext key from its MAC, the ID appears in subjects, logs and audit records
+// and must not allow to check guesses of the key without the pepper
+func plaintextKeyID(mac [sha256.Size]byte) string {
+	return plaintextKeyIDPrefix + hex.EncodeToString(mac[:6])
+}
+
+// plaintextKeyMAC is the fixed-length lookup digest of a plaintext key, HMAC-SHA256 with apiKeyPepper.
+// Presented tokens are only ever looked up by it, never by their raw value, so lookup timing depends
+// on a digest an attacker cannot compute and not on how much of a key was guessed right.
+func plaintextKeyMAC(key string) [sha256.Size]byte {
+	h := hmac.New(sha256.New, apiKeyPepper)
+	h.Write([]byte(key))
+	var mac [sha256.Size]byte
+	h.Sum(mac[:0])
+	return mac
+}
+
+type hmacVerifier struct {
+	mac [sha256.Size]byte
+}
+
+func (v *hmacVerifier) verify(secret string) bool {
+	mac := plaintextKeyMAC(secret)
+	return subtle.ConstantTimeCompare(mac[:], v.mac[:]) == 1
+}
+
+type sha256Verifier struct {
+	salt   []byte
+	digest []byte
+}
+
+func (v *sha256Verifier) verify(secret string) bool {
+	h := sha256.New()
+	h.Write(v.salt)
+	h.Write([]byte(secret))
+	return subtle.ConstantTimeCompare(h.Sum(nil), v.digest) == 1
+}
+
+type argon2idVerifier struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	hash    []byte
+}
+
+func (v *argon2idVerifier) verify(secret string) bool {
+	hash := argon2.IDKey([]byte(secret), v.salt, v.time, v.memory, v.threads, uint32(len(v.hash)))
+	return subtle.ConstantTimeCompare(hash, v.hash) == 1
+}
+
+type bcryptVerifier struct {
+	hash []byte
+}
+
+func (v *bcryptVerifier) verify(secret string) bool {
+	return bcrypt.CompareHashAndPassword(v.hash, []byte(secret)) == nil
+}
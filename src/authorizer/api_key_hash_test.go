@@ -0,0 +1,138 @@
+package authorizer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func sha256Hash(salt, secret string) string {
+	digest := sha256.Sum256([]byte(salt + secret))
+	return "sha256$" + base64.RawStdEncoding.EncodeToString([]byte(salt)) + "$" + base64.RawStdEncoding.EncodeToString(digest[:])
+}
+
+func TestParseKeySpec_Plaintext(t *testing.T) {
+	id, verifier, hashed, err := parseKeySpec("plain-key")
+	require.NoError(t, err)
+	assert.False(t, hashed)
+	assert.Equal(t, plaintextID("plain-key"), id)
+	assert.NotContains(t, id, "plain-key")
+	require.IsType(t, &hmacVerifier{}, verifier)
+	digest := sha256.Sum256([]byte("plain-key"))
+	assert.NotEqual(t, digest, verifier.(*hmacVerifier).mac, "plaintext keys are not kept as an unpeppered digest")
+	assert.True(t, verifier.verify("plain-key"))
+	assert.False(t, verifier.verify("plain-kez"))
+}
+
+func TestParseKeySpec_PlaintextWithDollar(t *testing.T) {
+	// only "<keyID>$<scheme>$" of a supported scheme is a hashed key
+	for _, spec := range []string{"pa$$word", "k1$md5$abc", "k1$sha256", "k1$$sha256$c2FsdA$AAAA", "$ecret"} {
+		id, verifier, hashed, err := parseKeySpec(spec)
+		require.NoError(t, err, spec)
+		assert.False(t, hashed, spec)
+		assert.Equal(t, plaintextID(spec), id, spec)
+		assert.True(t, verifier.verify(spec), spec)
+	}
+}
+
+func TestSetAPIKeyPepper(t *testing.T) {
+	pepper := apiKeyPepper
+	t.Cleanup(func() { apiKeyPepper = pepper })
+
+	require.ErrorContains(t, SetAPIKeyPepper("short"), "pepper must be at least 16 bytes")
+	assert.Equal(t, pepper, apiKeyPepper)
+
+	digest := sha256.Sum256([]byte("plain-key"))
+	require.NoError(t, SetAPIKeyPepper("0123456789abcdef"))
+	id, _, _, err := parseKeySpec("plain-key")
+	require.NoError(t, err)
+	assert.NotEqual(t, plaintextKeyID(digest), id, "the ID is not derived from the unpeppered digest")
+
+	require.NoError(t, SetAPIKeyPepper("0123456789abcdef"))
+	again, _, _, err := parseKeySpec("plain-key")
+	require.NoError(t, err)
+	assert.Equal(t, id, again, "the same pepper derives the same ID")
+
+	require.NoError(t, SetAPIKeyPepper("fedcba9876543210"))
+	other, _, _, err := parseKeySpec("plain-key")
+	require.NoError(t, err)
+	assert.NotEqual(t, id, other)
+}
+
+func TestParseKeySpec_Hashes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	salt := []byte("0123456789abcdef")
+	argonHash := argon2.IDKey([]byte("s3cret"), salt, 1, 64, 1, 32)
+
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"sha256", "k1$" + sha256Hash("salt", "s3cret")},
+		{"bcrypt", "k1" + string(bcryptHash)},
+		{"argon2id", "k1$argon2id$v=19$m=64,t=1,p=1$" +
+			base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(argonHash)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			id, verifier, hashed, err := parseKeySpec(tc.spec)
+			require.NoError(t, err)
+			assert.True(t, hashed)
+			assert.Equal(t, "k1", id)
+			assert.True(t, verifier.verify("s3cret"))
+			assert.False(t, verifier.verify("s3creT"))
+		})
+	}
+}
+
+func TestParseKeySpec_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"$sha256$c2FsdA$AAAA",   // missing key ID
+		"k1$sha256$c2FsdA$AAAA", // short digest
+		"k1$sha256$c2FsdA",      // missing digest
+		"k1$argon2id$v=1$m=64,t=1,p=1$c2FsdA$AAAA",
+		"k1$argon2id$v=19$m=64$c2FsdA$AAAA",
+		"k1$argon2id$v=19$m=64,t=0,p=0$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",     // no rounds, no threads
+		"k1$argon2id$v=19$m=64,t=1,p=0$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",     // no threads
+		"k1$argon2id$v=19$m=64,t=17,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",    // too many rounds
+		"k1$argon2id$v=19$m=31,t=1,p=4$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg",     // memory below 8*p
+		"k1$argon2id$v=19$m=131072,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$MDEyMzQ1Njc4OWFiY2RlZg", // 128 MiB memory
+		"k1$argon2id$v=19$m=64,t=1,p=1$c2FsdA$MDEyMzQ1Njc4OWFiY2RlZg",                     // short salt
+		"k1$argon2id$v=19$m=64,t=1,p=1$MDEyMzQ1Njc4OWFiY2RlZg$AAAA",                       // short hash
+		"k1$2a$xx$nope",
+		"k.1$sha256$c2FsdA$AAAA", // invalid key ID
+	} {
+		_, _, _, err := parseKeySpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestHashAPIKeySecret(t *testing.T) {
+	for _, scheme := range []string{hashSchemeSHA256, hashSchemeArgon2id, hashSchemeBcrypt} {
+		t.Run(scheme, func(t *testing.T) {
+			hash, err := HashAPIKeySecret("s3cret", scheme)
+			require.NoError(t, err)
+
+			verifier, err := parseSecretHash(hash)
+			require.NoError(t, err)
+			assert.Equal(t, scheme, hashScheme(verifier))
+			assert.True(t, verifier.verify("s3cret"))
+			assert.False(t, verifier.verify("s3cres"))
+
+			other, err := HashAPIKeySecret("s3cret", scheme)
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other, "salted")
+		})
+	}
+
+	_, err := HashAPIKeySecret("s3cret", "md5")
+	require.Error(t, err)
+	_, err = HashAPIKeySecret("", hashSchemeSHA256)
+	require.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package authorizer
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// APIKeysReport describes configured API keys the way the claim mappers load them, without any secret
+type APIKeysReport struct {
+	Keys     []APIKeyInfo     `json:"keys"`
+	Revoked  []RevokedKeyInfo `json:"revoked,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// APIKeyInfo is a single loaded key
+type APIKeyInfo struct {
+	// ID is the claims subject, derived from the key for plaintext keys
+	ID string `json:"id"`
+	// Scheme is plaintext, sha256, argon2id or bcrypt
+	Scheme     string `json:"scheme"`
+	SystemRole string `json:"systemRole,omitempty"`
+	// Namespaces maps namespaces and namespace patterns to roles
+	Namespaces  map[string]string `json:"namespaces,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	NotBefore   *time.Time        `json:"notBefore,omitempty"`
+	ExpiresAt   *time.Time        `json:"expiresAt,omitempty"`
+	RateLimit   *RateLimit        `json:"rateLimit,omitempty"`
+}
+
+// RevokedKeyInfo is a revocation list entry
+type RevokedKeyInfo struct {
+	// Key is the revoked key ID or "sha256:<hex>" token digest
+	Key       string     `json:"key"`
+	Reason    string     `json:"reason,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// InspectAPIKeys parses a TEMPORAL_API_KEYS string exactly like NewAPIKeyClaimMapper
+func InspectAPIKeys(apiKeysString string, now time.Time) (*APIKeysReport, error) {
+	keys, err := parseAPIKeysString(apiKeysString)
+	if err != nil {
+		return nil, err
+	}
+	return newAPIKeysReport(&apiKeySet{keys: keys}, now), nil
+}
+
+// InspectAPIKeysFile parses a TEMPORAL_API_KEYS_FILE registry exactly like NewAPIKeyFileClaimMapper
+func InspectAPIKeysFile(path string, now time.Time) (*APIKeysReport, error) {
+	set, err := parseAPIKeysFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newAPIKeysReport(set, now), nil
+}
+
+// newAPIKeysReport lists keys and revocations sorted by ID, with the warnings the claim mappers would log
+func newAPIKeysReport(set *apiKeySet, now time.Time) *APIKeysReport {
+	report := &APIKeysReport{Keys: []APIKeyInfo{}}
+	for _, id := range slices.Sorted(maps.Keys(set.keys)) {
+		key := set.keys[id]
+		info := APIKeyInfo{
+			ID:          id,
+			Scheme:      hashScheme(key.verifier),
+			SystemRole:  roleToPermission(key.claims.System),
+			Description: key.description,
+			Owner:       key.owner,
+			Metadata:    key.metadata,
+			NotBefore:   timeOrNil(key.notBefore),
+			ExpiresAt:   timeOrNil(key.expiresAt),
+			RateLimit:   rateLimitOf(key.claims),
+		}
+		if len(key.claims.Namespaces) > 0 || len(namespacePatterns(key.claims)) > 0 {
+			info.Namespaces = make(map[string]string)
+		}
+		for ns, role := range key.claims.Namespaces {
+			info.Namespaces[ns] = roleToPermission(role)
+		}
+		for _, p := range namespacePatterns(key.claims) {
+			info.Namespaces[p.Pattern] = roleToPermission(p.Role)
+		}
+		report.Keys = append(report.Keys, info)
+
+		if key.deprecatedSystemGrant {
+			report.Warnings = append(report.Warnings,
+				fmt.Sprintf(`key %s: "*" is deprecated, use "@system" for a system role or "@all" for every namespace`, id))
+		}
+		if !key.expiresAt.IsZero() && !now.Before(key.expiresAt) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("key %s: expired at %s", id, key.expiresAt.Format(time.RFC3339)))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(set.revoked)) {
+		r := set.revoked[key]
+		report.Revoked = append(report.Revoked, RevokedKeyInfo{Key: key, Reason: r.reason, RevokedAt: timeOrNil(r.revokedAt)})
+	}
+	return report
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,62 @@
+package authorizer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectAPIKeys(t *testing.T) {
+	report, err := InspectAPIKeys("plain:write:orders,read:team-*;legacy:admin:*;ci-bot$"+sha256Hash("salt", "s3cret")+":admin:@system", time.Now())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []APIKeyInfo{
+		{ID: "ci-bot", Scheme: "sha256", SystemRole: "admin"},
+		{ID: plaintextID("legacy"), Scheme: "plaintext", SystemRole: "admin"},
+		{ID: plaintextID("plain"), Scheme: "plaintext", Namespaces: map[string]string{"orders": "write", "team-*": "read"}},
+	}, report.Keys)
+	assert.True(t, slices.IsSortedFunc(report.Keys, func(a, b APIKeyInfo) int { return strings.Compare(a.ID, b.ID) }))
+	require.Len(t, report.Warnings, 1)
+	assert.Contains(t, report.Warnings[0], plaintextID("legacy"))
+	assert.Empty(t, report.Revoked)
+
+	_, err = InspectAPIKeys("k:write:orders;k:read:orders", time.Now())
+	require.Error(t, err)
+}
+
+func TestInspectAPIKeysFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+keys:
+  - id: contractor
+    owner: platform-team
+    secretHash: "$`+sha256Hash("salt", "s3cret")+`"
+    namespaces: {"@all": read}
+    expiresAt: 2026-02-01T00:00:00Z
+revoked:
+  - id: old-bot
+    reason: leaked
+`), 0o600))
+
+	report, err := InspectAPIKeysFile(path, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	expiresAt := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []APIKeyInfo{{
+		ID:         "contractor",
+		Scheme:     "sha256",
+		Owner:      "platform-team",
+		Namespaces: map[string]string{"@all": "read"},
+		ExpiresAt:  &expiresAt,
+	}}, report.Keys)
+	assert.Equal(t, []RevokedKeyInfo{{Key: "old-bot", Reason: "leaked"}}, report.Revoked)
+	assert.Equal(t, []string{"key contractor: expired at 2026-02-01T00:00:00Z"}, report.Warnings)
+
+	_, err = InspectAPIKeysFile(filepath.Join(t.TempDir(), "missing.yaml"), time.Now())
+	require.Error(t, err)
+}
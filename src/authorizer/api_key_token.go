@@ -0,0 +1,98 @@
+package authorizer
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strings"
+)
+
+const (
+	// apiKeyTokenPrefix marks a structured key "tmprl_<keyID>_<secret>_<checksum>"
+	apiKeyTokenPrefix = "tmprl_"
+	// apiKeySecretLength is the number of base62 characters of a structured key secret
+	apiKeySecretLength = 32
+	// apiKeyChecksumLength is the number of hex characters of the CRC-32 of everything before it
+	apiKeyChecksumLength = 8
+
+	base62Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	apiKeySecretPattern   = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+	apiKeyChecksumPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+	// errAPIKeyMalformed is a structured key which does not have the expected parts
+	errAPIKeyMalformed = errors.New("malformed api key")
+	// errAPIKeyChecksum is a well-formed structured key with a wrong checksum, most likely a typo
+	errAPIKeyChecksum = errors.New("api key checksum mismatch")
+)
+
+// GenerateAPIKey returns a new structured key "tmprl_<keyID>_<secret>_<checksum>" and its secret,
+// which is what the key's secretHash is computed from.
+func GenerateAPIKey(keyID string) (token string, secret string, err error) {
+	if !keyIDPattern.MatchString(keyID) {
+		return "", "", fmt.Errorf("invalid key ID %q - expected [A-Za-z0-9_-]+", keyID)
+	}
+	secret, err = randomBase62(apiKeySecretLength)
+	if err != nil {
+		return "", "", err
+	}
+	return formatAPIKeyToken(keyID, secret), secret, nil
+}
+
+func formatAPIKeyToken(keyID, secret string) string {
+	body := apiKeyTokenPrefix + keyID + "_" + secret
+	return fmt.Sprintf("%s_%0*x", body, apiKeyChecksumLength, crc32.ChecksumIEEE([]byte(body)))
+}
+
+// parseAPIKeyToken splits a structured key into its key ID and secret. The secret and the checksum never
+// contain "_", so the key ID is everything between the prefix and the secret and may contain "_" itself.
+// A token with a wrong checksum is reported as errAPIKeyChecksum, anything else as errAPIKeyMalformed.
+func parseAPIKeyToken(token string) (keyID string, secret string, err error) {
+	rest, ok := strings.CutPrefix(token, apiKeyTokenPrefix)
+	if !ok {
+		return "", "", errAPIKeyMalformed
+	}
+	body, checksum, ok := cutLast(rest, "_")
+	if !ok || len(checksum) != apiKeyChecksumLength || !apiKeyChecksumPattern.MatchString(checksum) {
+		return "", "", errAPIKeyMalformed
+	}
+	keyID, secret, ok = cutLast(body, "_")
+	if !ok || len(secret) != apiKeySecretLength || !apiKeySecretPattern.MatchString(secret) || !keyIDPattern.MatchString(keyID) {
+		return "", "", errAPIKeyMalformed
+	}
+	if formatAPIKeyToken(keyID, secret) != token {
+		return keyID, "", errAPIKeyChecksum
+	}
+	return keyID, secret, nil
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// randomBase62 returns n uniformly distributed base62 characters
+func randomBase62(n int) (string, error) {
+	// bytes >= 248 (4*62) are skipped so every character is equally likely
+	const limit = 256 - 256%len(base62Alphabet)
+	var sb strings.Builder
+	buf := make([]byte, n)
+	for sb.Len() < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("generate api key secret: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && sb.Len() < n {
+				sb.WriteByte(base62Alphabet[int(b)%len(base62Alphabet)])
+			}
+		}
+	}
+	return sb.String(), nil
+}
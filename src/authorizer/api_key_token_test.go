@@ -0,0 +1,54 @@
+package authorizer
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	token, secret, err := GenerateAPIKey("ci_bot-1")
+	require.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^tmprl_ci_bot-1_[A-Za-z0-9]{32}_[0-9a-f]{8}$`), token)
+	assert.Contains(t, token, "_"+secret+"_")
+
+	id, parsedSecret, err := parseAPIKeyToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "ci_bot-1", id)
+	assert.Equal(t, secret, parsedSecret)
+
+	other, _, err := GenerateAPIKey("ci_bot-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	_, _, err = GenerateAPIKey("ci.bot")
+	require.Error(t, err)
+}
+
+func TestParseAPIKeyToken_Invalid(t *testing.T) {
+	valid := formatAPIKeyToken("ci-bot", strings.Repeat("a", apiKeySecretLength))
+	// replace the last secret character, the checksum no longer matches
+	typo := valid[:len(valid)-apiKeyChecksumLength-2] + "b" + valid[len(valid)-apiKeyChecksumLength-1:]
+
+	id, _, err := parseAPIKeyToken(typo)
+	require.ErrorIs(t, err, errAPIKeyChecksum)
+	assert.Equal(t, "ci-bot", id, "the key ID is known for a checksum mismatch")
+
+	for _, token := range []string{
+		"ci-bot.secret",
+		"tmprl_",
+		"tmprl_ci-bot_" + strings.Repeat("a", apiKeySecretLength),
+		"tmprl_ci-bot_" + strings.Repeat("a", apiKeySecretLength-1) + "_00000000",
+		"tmprl_ci-bot_" + strings.Repeat("a", apiKeySecretLength) + "_0000000",
+		"tmprl_ci-bot_" + strings.Repeat("a", apiKeySecretLength) + "_ABCDEF01",
+		"tmprl_ci-bot_" + strings.Repeat("-", apiKeySecretLength) + "_00000000",
+		"tmprl__" + strings.Repeat("a", apiKeySecretLength) + "_00000000",
+		"tmprl_ci.bot_" + strings.Repeat("a", apiKeySecretLength) + "_00000000",
+	} {
+		_, _, err := parseAPIKeyToken(token)
+		assert.ErrorIs(t, err, errAPIKeyMalformed, token)
+	}
+}
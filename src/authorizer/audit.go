@@ -0,0 +1,186 @@
+package authorizer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	auditDecisionAllow = "allow"
+	auditDecisionDeny  = "deny"
+
+	// defaultAuditBufferSize is the number of events buffered for the sink before new ones are dropped
+	defaultAuditBufferSize = 10000
+)
+
+// AuditEvent is a single authorization decision. It never carries credentials: the subject is the API key ID
+// or the JWT subject, never a key, secret or token.
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	// ClaimMappers which recognized the credentials
+	ClaimMappers []string `json:"claimMappers,omitempty"`
+	Subject      string   `json:"subject,omitempty"`
+	Namespace    string   `json:"namespace,omitempty"`
+	API          string   `json:"api,omitempty"`
+	// Decision is allow or deny
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+	Peer     string `json:"peer,omitempty"`
+}
+
+// AuditSink writes audit events, it is only called from the Auditor goroutine
+type AuditSink interface {
+	Write(event *AuditEvent) error
+	Close() error
+}
+
+// Auditor hands audit events to a sink asynchronously, so a slow sink never delays authorization.
+// When the buffer is full new events are dropped and counted. A nil Auditor records nothing.
+type Auditor struct {
+	sink    AuditSink
+	logger  logpkg.Logger
+	now     func() time.Time
+	events  chan *AuditEvent
+	dropped atomic.Int64
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditor starts writing recorded events to sink, bufferSize 0 uses the default
+func NewAuditor(sink AuditSink, bufferSize int, logger logpkg.Logger) *Auditor {
+	if bufferSize <= 0 {
+		bufferSize = defaultAuditBufferSize
+	}
+	a := &Auditor{
+		sink:   sink,
+		logger: logger,
+		now:    time.Now,
+		events: make(chan *AuditEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Record queues the event without blocking, Time is set if missing
+func (a *Auditor) Record(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = a.now()
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.events <- &event:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Close writes the buffered events and closes the sink
+func (a *Auditor) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.events)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.sink.Close()
+}
+
+func (a *Auditor) run() {
+	defer close(a.done)
+	for event := range a.events {
+		if err := a.sink.Write(event); err != nil {
+			a.logger.Warn("auth: audit event write failed", tag.Error(err))
+		}
+		if dropped := a.dropped.Swap(0); dropped > 0 {
+			a.logger.Warn("auth: audit buffer full, events dropped", tag.NewInt64("dropped", dropped))
+		}
+	}
+}
+
+type auditAuthorizer struct {
+	next    authorization.Authorizer
+	auditor *Auditor
+}
+
+// NewAuditAuthorizer records the decision of next for every call but health checks.
+// Credentials a claim mapper rejected are recorded with the claim mapper and its error, see
+// MultiClaimMapper.SetDeferRejections; a terminal rejection is denied without asking next, except for health checks.
+func NewAuditAuthorizer(next authorization.Authorizer, auditor *Auditor) authorization.Authorizer {
+	return &auditAuthorizer{next: next, auditor: auditor}
+}
+
+// Authorize asks the next authorizer and records its decision, an error is recorded as a deny
+func (a *auditAuthorizer) Authorize(ctx context.Context, claims *authorization.Claims, target *authorization.CallTarget) (authorization.Result, error) {
+	if authorization.IsHealthCheckAPI(target.APIName) {
+		// the default authorizer allows health checks whatever the credentials, even rejected ones
+		return a.next.Authorize(ctx, claims, target)
+	}
+	rejections, terminal := rejectionsOf(claims)
+	var result authorization.Result
+	var err error
+	if terminal != nil {
+		result = authorization.Result{Decision: authorization.DecisionDeny, Reason: terminal.Message}
+	} else {
+		result, err = a.next.Authorize(ctx, claims, target)
+	}
+
+	event := AuditEvent{
+		Namespace: target.Namespace,
+		API:       target.APIName,
+		Decision:  auditDecisionDeny,
+		Reason:    result.Reason,
+	}
+	if claims != nil {
+		event.Subject = claims.Subject
+		if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil {
+			event.ClaimMappers = ext.ClaimMappers
+		}
+	}
+	switch {
+	case terminal != nil:
+		event.ClaimMappers = []string{terminal.ClaimMapper}
+	case len(rejections) > 0 && !hasClaims(claims):
+		// no claim mapper recognized the credentials, the reasons are the rejections
+		reasons := make([]string, 0, len(rejections))
+		for _, r := range rejections {
+			event.ClaimMappers = append(event.ClaimMappers, r.ClaimMapper)
+			reasons = append(reasons, r.ClaimMapper+": "+r.Message)
+		}
+		if event.Reason == "" {
+			event.Reason = strings.Join(reasons, "; ")
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		event.Peer = p.Addr.String()
+	}
+	switch {
+	case err != nil:
+		event.Reason = err.Error()
+	case result.Decision == authorization.DecisionAllow:
+		event.Decision = auditDecisionAllow
+	}
+	a.auditor.Record(event)
+	return result, err
+}
@@ -0,0 +1,141 @@
+package authorizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	auditSinkStdout = "stdout"
+	auditSinkFile   = "file"
+	auditSinkSyslog = "syslog"
+
+	// syslog facility authpriv (10), severity info (6) for allowed and notice (5) for denied calls
+	syslogPriorityAllow = 10*8 + 6
+	syslogPriorityDeny  = 10*8 + 5
+	syslogAppName       = "temporal-frontend"
+)
+
+// AuditConfig selects where audit events are written
+type AuditConfig struct {
+	// Sink is stdout, file (JSON lines) or syslog (RFC 5424 over UDP)
+	Sink string `yaml:"sink"`
+	// Path of the JSON lines file, appended to
+	Path string `yaml:"path"`
+	// Address of the syslog endpoint, "host:port"
+	Address string `yaml:"address"`
+	// BufferSize is the number of events buffered before new ones are dropped, 10000 by default
+	BufferSize int `yaml:"bufferSize"`
+}
+
+func (c *AuditConfig) validate() error {
+	switch c.Sink {
+	case auditSinkStdout:
+	case auditSinkFile:
+		if c.Path == "" {
+			return fmt.Errorf("path: required for the file sink")
+		}
+	case auditSinkSyslog:
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("address: expected host:port for the syslog sink: %w", err)
+		}
+	default:
+		return fmt.Errorf("sink: expected %s, %s or %s, got %q", auditSinkStdout, auditSinkFile, auditSinkSyslog, c.Sink)
+	}
+	if c.BufferSize < 0 {
+		return fmt.Errorf("bufferSize: must not be negative")
+	}
+	return nil
+}
+
+// NewAuditSink opens the configured sink
+func NewAuditSink(cfg AuditConfig) (AuditSink, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Sink {
+	case auditSinkFile:
+		f, err := os.OpenFile(filepath.Clean(cfg.Path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("audit file: %w", err)
+		}
+		return newJSONLinesAuditSink(f, f), nil
+	case auditSinkSyslog:
+		conn, err := net.Dial("udp", cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("audit syslog: %w", err)
+		}
+		return newSyslogAuditSink(conn), nil
+	}
+	return newJSONLinesAuditSink(os.Stdout, nil), nil
+}
+
+// jsonLinesAuditSink writes one JSON object per line
+type jsonLinesAuditSink struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// newJSONLinesAuditSink writes to w, closer (if not nil) is closed with the sink
+func newJSONLinesAuditSink(w io.Writer, closer io.Closer) *jsonLinesAuditSink {
+	bw := bufio.NewWriter(w)
+	return &jsonLinesAuditSink{w: bw, encoder: json.NewEncoder(bw), closer: closer}
+}
+
+func (s *jsonLinesAuditSink) Write(event *AuditEvent) error {
+	if err := s.encoder.Encode(event); err != nil {
+		return err
+	}
+	// flushed per event, a crash must not lose events the buffer already accepted
+	return s.w.Flush()
+}
+
+func (s *jsonLinesAuditSink) Close() error {
+	err := s.w.Flush()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// syslogAuditSink sends every event as an RFC 5424 message with the JSON event as message
+type syslogAuditSink struct {
+	conn     net.Conn
+	hostname string
+}
+
+func newSyslogAuditSink(conn net.Conn) *syslogAuditSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &syslogAuditSink{conn: conn, hostname: hostname}
+}
+
+func (s *syslogAuditSink) Write(event *AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	priority := syslogPriorityDeny
+	if event.Decision == auditDecisionAllow {
+		priority = syslogPriorityAllow
+	}
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	_, err = fmt.Fprintf(s.conn, "<%d>1 %s %s %s %d audit - %s",
+		priority, event.Time.UTC().Format(time.RFC3339Nano), s.hostname, syslogAppName, os.Getpid(), data)
+	return err
+}
+
+func (s *syslogAuditSink) Close() error {
+	return s.conn.Close()
+}
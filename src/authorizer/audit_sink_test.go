@@ -0,0 +1,107 @@
+package authorizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     AuditConfig
+		wantErr string
+	}{
+		{"stdout", AuditConfig{Sink: "stdout"}, ""},
+		{"file", AuditConfig{Sink: "file", Path: "audit.jsonl"}, ""},
+		{"syslog", AuditConfig{Sink: "syslog", Address: "127.0.0.1:514"}, ""},
+		{"unknown sink", AuditConfig{Sink: "kafka"}, `sink: expected stdout, file or syslog, got "kafka"`},
+		{"file without path", AuditConfig{Sink: "file"}, "path: required"},
+		{"syslog without port", AuditConfig{Sink: "syslog", Address: "localhost"}, "address: expected host:port"},
+		{"negative buffer", AuditConfig{Sink: "stdout", BufferSize: -1}, "bufferSize:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAuditSink_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"decision":"allow"}`+"\n"), 0o600))
+
+	sink, err := NewAuditSink(AuditConfig{Sink: "file", Path: path})
+	require.NoError(t, err)
+	event := &AuditEvent{
+		Time:      time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		Subject:   "ci-bot",
+		Namespace: "orders",
+		API:       apiStart,
+		Decision:  auditDecisionDeny,
+		Reason:    "denied by authorization rule no-terminate",
+	}
+	require.NoError(t, sink.Write(event))
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, lines, 2, "the file is appended to")
+
+	var got AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &got))
+	assert.Equal(t, *event, got)
+	assert.NotContains(t, lines[1], "claimMappers", "empty fields are omitted")
+}
+
+func TestAuditSink_Syslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewAuditSink(AuditConfig{Sink: "syslog", Address: conn.LocalAddr().String()})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	read := func() string {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 64*1024)
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, sink.Write(&AuditEvent{Time: at, Subject: "ci-bot", Decision: auditDecisionAllow}))
+	msg := read()
+	assert.True(t, strings.HasPrefix(msg, "<86>1 2025-03-01T12:00:00Z "), msg)
+	assert.Contains(t, msg, " temporal-frontend ")
+	_, payload, found := strings.Cut(msg, " audit - ")
+	require.True(t, found, msg)
+	var got AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(payload), &got))
+	assert.Equal(t, "ci-bot", got.Subject)
+
+	require.NoError(t, sink.Write(&AuditEvent{Time: at, Decision: auditDecisionDeny}))
+	assert.True(t, strings.HasPrefix(read(), "<85>1 "))
+}
@@ -0,0 +1,198 @@
+package authorizer
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+	"google.golang.org/grpc/peer"
+)
+
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	events  []AuditEvent
+	closed  bool
+	release chan struct{}
+}
+
+func (s *memoryAuditSink) Write(event *AuditEvent) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func (s *memoryAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestAuditor_CloseFlushes(t *testing.T) {
+	sink := &memoryAuditSink{}
+	auditor := NewAuditor(sink, 0, log.NewTestLogger())
+	for _, ns := range []string{"a", "b", "c"} {
+		auditor.Record(AuditEvent{Namespace: ns, Decision: auditDecisionAllow})
+	}
+	require.NoError(t, auditor.Close())
+	require.NoError(t, auditor.Close())
+	auditor.Record(AuditEvent{Namespace: "after-close"})
+
+	require.Len(t, sink.events, 3)
+	assert.True(t, sink.closed)
+	for i, ns := range []string{"a", "b", "c"} {
+		assert.Equal(t, ns, sink.events[i].Namespace)
+		assert.False(t, sink.events[i].Time.IsZero())
+	}
+}
+
+func TestAuditor_FullBufferDrops(t *testing.T) {
+	sink := &memoryAuditSink{release: make(chan struct{})}
+	auditor := NewAuditor(sink, 1, log.NewTestLogger())
+	// the sink is stuck: one event in flight at most, one buffered, the rest must be dropped without blocking
+	for range 5 {
+		auditor.Record(AuditEvent{Decision: auditDecisionDeny})
+	}
+	close(sink.release)
+	require.NoError(t, auditor.Close())
+	assert.LessOrEqual(t, len(sink.events), 2)
+	assert.NotEmpty(t, sink.events)
+}
+
+func TestAuditor_Nil(t *testing.T) {
+	var auditor *Auditor
+	assert.NotPanics(t, func() { auditor.Record(AuditEvent{}) })
+}
+
+func TestAuditAuthorizer(t *testing.T) {
+	sink := &memoryAuditSink{}
+	auditor := NewAuditor(sink, 0, log.NewTestLogger())
+	authz := NewAuditAuthorizer(authorization.NewDefaultAuthorizer(), auditor)
+
+	claims := &authorization.Claims{Subject: "ci-bot", Namespaces: map[string]authorization.Role{"orders": authorization.RoleWriter}}
+	extensionsOf(claims).ClaimMappers = []string{"apiKey"}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 52100}})
+
+	result, err := authz.Authorize(ctx, claims, &authorization.CallTarget{APIName: apiStart, Namespace: "orders"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.DecisionAllow, result.Decision)
+
+	result, err = authz.Authorize(ctx, claims, &authorization.CallTarget{APIName: apiStart, Namespace: "billing"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.DecisionDeny, result.Decision)
+
+	_, err = authz.Authorize(context.Background(), nil, &authorization.CallTarget{APIName: apiHealth})
+	require.NoError(t, err)
+	require.NoError(t, auditor.Close())
+
+	require.Len(t, sink.events, 2, "health checks are not audited")
+	allowed, denied := sink.events[0], sink.events[1]
+	assert.Equal(t, AuditEvent{
+		Time:         allowed.Time,
+		ClaimMappers: []string{"apiKey"},
+		Subject:      "ci-bot",
+		Namespace:    "orders",
+		API:          apiStart,
+		Decision:     auditDecisionAllow,
+		Peer:         "10.0.0.7:52100",
+	}, allowed)
+	assert.Equal(t, auditDecisionDeny, denied.Decision)
+	assert.Equal(t, "billing", denied.Namespace)
+}
+
+func TestAuditAuthorizer_Error(t *testing.T) {
+	sink := &memoryAuditSink{}
+	auditor := NewAuditor(sink, 0, log.NewTestLogger())
+	authz := NewAuditAuthorizer(authorizerFunc(func(context.Context, *authorization.Claims, *authorization.CallTarget) (authorization.Result, error) {
+		return authorization.Result{}, assert.AnError
+	}), auditor)
+
+	_, err := authz.Authorize(context.Background(), &authorization.Claims{Subject: "ci-bot"}, &authorization.CallTarget{APIName: apiStart, Namespace: "orders"})
+	require.ErrorIs(t, err, assert.AnError)
+	require.NoError(t, auditor.Close())
+
+	require.Len(t, sink.events, 1)
+	assert.Equal(t, auditDecisionDeny, sink.events[0].Decision)
+	assert.Equal(t, assert.AnError.Error(), sink.events[0].Reason)
+}
+
+type authorizerFunc func(context.Context, *authorization.Claims, *authorization.CallTarget) (authorization.Result, error)
+
+func (f authorizerFunc) Authorize(ctx context.Context, claims *authorization.Claims, target *authorization.CallTarget) (authorization.Result, error) {
+	return f(ctx, claims, target)
+}
+
+func TestAudit_NoCredentials(t *testing.T) {
+	logger := log.NewTestLogger()
+	secret := "Xk3pQ9rT2vW8yZ1aB4cD6eF0gH5jK7mN"
+	apiKeys, err := NewAPIKeyClaimMapper("ci_bot$"+sha256Hash("salt", secret)+":write:orders", logger)
+	require.NoError(t, err)
+
+	sink := &memoryAuditSink{}
+	auditor := NewAuditor(sink, 0, logger)
+	claimMappers := NewMultiClaimMapper(logger)
+	claimMappers.Add("apiKey", apiKeys)
+	claimMappers.SetDeferRejections(true)
+	authz := NewAuditAuthorizer(authorization.NewDefaultAuthorizer(), auditor)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 7), Port: 52100}})
+	target := &authorization.CallTarget{APIName: apiStart, Namespace: "orders"}
+
+	token := formatAPIKeyToken("ci_bot", secret)
+	claims, err := claimMappers.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + token})
+	require.NoError(t, err)
+	_, err = authz.Authorize(ctx, claims, target)
+	require.NoError(t, err)
+
+	// a typo in the token is rejected for good by the claim mapper, the authorizer denies and records the call
+	typo := token[:len(token)-1] + "0"
+	if typo == token {
+		typo = token[:len(token)-1] + "1"
+	}
+	claims, err = claimMappers.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + typo})
+	require.NoError(t, err)
+	assert.False(t, hasClaims(claims))
+	result, err := authz.Authorize(ctx, claims, target)
+	require.NoError(t, err)
+	assert.Equal(t, authorization.Result{Decision: authorization.DecisionDeny, Reason: errAPIKeyChecksum.Error()}, result)
+	// health checks are still allowed and not recorded
+	result, err = authz.Authorize(ctx, claims, &authorization.CallTarget{APIName: apiHealth})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.DecisionAllow, result.Decision)
+
+	// a wrong secret is not a terminal rejection, but no claim mapper recognized the credentials
+	claims, err = claimMappers.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci_bot.wrong"})
+	require.NoError(t, err)
+	result, err = authz.Authorize(ctx, claims, target)
+	require.NoError(t, err)
+	assert.Equal(t, authorization.DecisionDeny, result.Decision)
+	require.NoError(t, auditor.Close())
+
+	require.Len(t, sink.events, 3)
+	assert.Equal(t, "ci_bot", sink.events[0].Subject)
+	assert.Equal(t, auditDecisionAllow, sink.events[0].Decision)
+	for _, event := range sink.events[1:] {
+		assert.Equal(t, []string{"apiKey"}, event.ClaimMappers)
+		assert.Equal(t, auditDecisionDeny, event.Decision)
+		assert.Equal(t, "orders", event.Namespace)
+		assert.Equal(t, apiStart, event.API)
+		assert.Equal(t, "10.0.0.7:52100", event.Peer)
+	}
+	assert.Equal(t, errAPIKeyChecksum.Error(), sink.events[1].Reason)
+	assert.Equal(t, "apiKey: invalid api key", sink.events[2].Reason)
+
+	data, err := json.Marshal(sink.events)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), secret)
+	assert.NotContains(t, string(data), token)
+	assert.NotContains(t, string(data), typo)
+}
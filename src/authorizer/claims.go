@@ -0,0 +1,163 @@
+package authorizer
+
+import (
+	"maps"
+	"slices"
+
+	"go.temporal.io/server/common/authorization"
+)
+
+// ClaimsExtensions is set as authorization.Claims.Extensions by MultiClaimMapper
+type ClaimsExtensions struct {
+	// ClaimMappers which contributed to the claims, in the order they were asked
+	ClaimMappers []string
+	// NamespacePatterns grant roles on namespaces not known upfront, see NewNamespacePatternAuthorizer
+	NamespacePatterns []NamespacePattern
+	// RateLimit of the API key, see RateLimitInterceptor
+	RateLimit *RateLimit
+	// Subjects of the primary and the secondary credential, see NewSecondaryCredentialClaimMapper
+	Subjects []string
+	// KeyID of the API key the claims were mapped from, empty for other credentials
+	KeyID string
+	// Rejections of the credentials by claim mappers, see MultiClaimMapper.SetDeferRejections
+	Rejections []ClaimMapperRejection
+}
+
+// ClaimMapperRejection is credentials a claim mapper rejected
+type ClaimMapperRejection struct {
+	ClaimMapper string
+	// Reason is a bounded label, e.g. revoked or checksum, the metrics reason
+	Reason string
+	// Message is the error the claim mapper rejected the credentials with
+	Message string
+	// Terminal rejections deny the call whatever the authorizer decides
+	Terminal bool
+}
+
+// rejectionsOf returns the claim mapper rejections of the claims and the terminal one, if any
+func rejectionsOf(claims *authorization.Claims) ([]ClaimMapperRejection, *ClaimMapperRejection) {
+	if claims == nil {
+		return nil, nil
+	}
+	ext, ok := claims.Extensions.(*ClaimsExtensions)
+	if !ok || ext == nil {
+		return nil, nil
+	}
+	for i := range ext.Rejections {
+		if ext.Rejections[i].Terminal {
+			return ext.Rejections, &ext.Rejections[i]
+		}
+	}
+	return ext.Rejections, nil
+}
+
+// extensionsOf returns the claims extensions, creating them if missing
+func extensionsOf(claims *authorization.Claims) *ClaimsExtensions {
+	ext, ok := claims.Extensions.(*ClaimsExtensions)
+	if !ok || ext == nil {
+		ext = &ClaimsExtensions{}
+		claims.Extensions = ext
+	}
+	return ext
+}
+
+// cloneClaims returns a copy which can be modified without touching the claims a mapper may keep and return again
+func cloneClaims(claims *authorization.Claims) *authorization.Claims {
+	c := *claims
+	c.Namespaces = maps.Clone(claims.Namespaces)
+	if c.Namespaces == nil {
+		c.Namespaces = map[string]authorization.Role{}
+	}
+	if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil {
+		extCopy := *ext
+		extCopy.ClaimMappers = slices.Clone(ext.ClaimMappers)
+		extCopy.NamespacePatterns = slices.Clone(ext.NamespacePatterns)
+		extCopy.Subjects = slices.Clone(ext.Subjects)
+		extCopy.Rejections = slices.Clone(ext.Rejections)
+		c.Extensions = &extCopy
+	}
+	return &c
+}
+
+// namespacePatterns of the claims, if any
+func namespacePatterns(claims *authorization.Claims) []NamespacePattern {
+	if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil {
+		return ext.NamespacePatterns
+	}
+	return nil
+}
+
+// unionClaims keeps every role per namespace (and system) and all namespace patterns of both claims, roles are
+// bitmasks so combined roles like read+worker keep the worker bit next to a higher role. Like the subject, the rate
+// limit is the first claims' one if set.
+func unionClaims(a, b *authorization.Claims) *authorization.Claims {
+	c := cloneClaims(a)
+	inheritRateLimit(c, b)
+	c.System = withoutImpliedRoles(a.System | b.System)
+	for namespace, role := range b.Namespaces {
+		c.Namespaces[namespace] = withoutImpliedRoles(c.Namespaces[namespace] | role)
+	}
+	if patterns := namespacePatterns(b); len(patterns) > 0 {
+		ext := extensionsOf(c)
+		ext.NamespacePatterns = append(ext.NamespacePatterns, patterns...)
+	}
+	return c
+}
+
+// intersectClaims keeps per namespace the roles both effective roles grant (system role and patterns included),
+// a namespace missing from either claims is dropped unless covered by its system role or a pattern.
+// Patterns themselves are not intersected, only the namespaces named explicitly by either claims are kept.
+func intersectClaims(a, b *authorization.Claims) *authorization.Claims {
+	c := cloneClaims(a)
+	inheritRateLimit(c, b)
+	c.System = intersectRoles(a.System, b.System)
+	c.Namespaces = map[string]authorization.Role{}
+	if ext, ok := c.Extensions.(*ClaimsExtensions); ok {
+		ext.NamespacePatterns = nil
+	}
+	for _, namespace := range slices.Concat(slices.Collect(maps.Keys(a.Namespaces)), slices.Collect(maps.Keys(b.Namespaces))) {
+		role := intersectRoles(
+			a.System|a.Namespaces[namespace]|namespacePatternRole(a, namespace),
+			b.System|b.Namespaces[namespace]|namespacePatternRole(b, namespace),
+		)
+		if role != authorization.RoleUndefined {
+			c.Namespaces[namespace] = role
+		}
+	}
+	return c
+}
+
+// intersectRoles is the bitwise and of two roles. Like the ">=" check of the default authorizer, admin covers write
+// and write covers read, so admin and write intersect to write while worker only intersects with worker.
+func intersectRoles(a, b authorization.Role) authorization.Role {
+	return withoutImpliedRoles(impliedRoles(a) & impliedRoles(b))
+}
+
+// impliedRoles adds the roles covered by the highest of admin, write and read to role
+func impliedRoles(role authorization.Role) authorization.Role {
+	if role&authorization.RoleAdmin != 0 {
+		role |= authorization.RoleWriter
+	}
+	if role&authorization.RoleWriter != 0 {
+		role |= authorization.RoleReader
+	}
+	return role
+}
+
+// withoutImpliedRoles is the inverse of impliedRoles, it keeps the highest of admin, write and read and the worker bit
+func withoutImpliedRoles(role authorization.Role) authorization.Role {
+	if role&(authorization.RoleWriter|authorization.RoleAdmin) != 0 {
+		role &^= authorization.RoleReader
+	}
+	if role&authorization.RoleAdmin != 0 {
+		role &^= authorization.RoleWriter
+	}
+	return role
+}
+
+// inheritRateLimit sets the rate limit of b on c unless c has one already
+func inheritRateLimit(c, b *authorization.Claims) {
+	if limit := rateLimitOf(b); limit != nil && rateLimitOf(c) == nil {
+		extensionsOf(c).RateLimit = limit
+	}
+}
@@ -0,0 +1,101 @@
+package authorizer
+
+import (
+	"fmt"
+
+	"go.temporal.io/server/common/authorization"
+)
+
+type (
+	// ClaimMapperPolicy is applied to the claims of a single claim mapper, only if it recognized the credentials.
+	// Grants are added first, then forced roles are set and finally every role is capped at MaxRole.
+	ClaimMapperPolicy struct {
+		// Grants are added to the claims, the highest role wins
+		Grants RoleGrants `yaml:"grants"`
+		// Force sets roles of namespaces named exactly regardless of what the claim mapper returned
+		Force map[string]string `yaml:"force"`
+		// MaxRole caps the system role and every namespace role
+		MaxRole string `yaml:"maxRole"`
+	}
+
+	// RoleGrants is a system role and roles per namespace, a namespace may be a glob, an anchored /regex/,
+	// "@all" or "@system" like in the other mappings
+	RoleGrants struct {
+		System     string            `yaml:"system"`
+		Namespaces map[string]string `yaml:"namespaces"`
+	}
+
+	// claimsPolicy is the validated ClaimMapperPolicy
+	claimsPolicy struct {
+		// grants holds the system role, namespace roles and namespace patterns to add
+		grants  *authorization.Claims
+		force   map[string]authorization.Role
+		maxRole authorization.Role
+	}
+)
+
+func (p *ClaimMapperPolicy) compile() (*claimsPolicy, error) {
+	compiled := &claimsPolicy{
+		grants: &authorization.Claims{Namespaces: make(map[string]authorization.Role, len(p.Grants.Namespaces))},
+		force:  make(map[string]authorization.Role, len(p.Force)),
+	}
+	var err error
+	if p.Grants.System != "" {
+		if compiled.grants.System, err = parseRole(p.Grants.System); err != nil {
+			return nil, fmt.Errorf("grants.system: %w", err)
+		}
+	}
+	for namespace, permission := range p.Grants.Namespaces {
+		if namespace == namespaceSystemDeprecated {
+			return nil, fmt.Errorf("grants.namespaces.%s: %w", namespace, errAmbiguousNamespace)
+		}
+		role, err := parseRole(permission)
+		if err != nil {
+			return nil, fmt.Errorf("grants.namespaces.%s: %w", namespace, err)
+		}
+		if err := addGrant(compiled.grants, role, namespace); err != nil {
+			return nil, fmt.Errorf("grants.namespaces.%s: %w", namespace, err)
+		}
+	}
+	for namespace, permission := range p.Force {
+		// a forced role overrides the mapped one, which is only defined for a namespace named exactly
+		if pattern, err := parseNamespacePattern(namespace, authorization.RoleUndefined); err != nil || pattern != nil || namespace == namespaceSystem {
+			return nil, fmt.Errorf("force.%s: only namespace names can be forced, use grants or maxRole for %q", namespace, namespace)
+		}
+		if compiled.force[namespace], err = parseRole(permission); err != nil {
+			return nil, fmt.Errorf("force.%s: %w", namespace, err)
+		}
+	}
+	if p.MaxRole != "" {
+		if compiled.maxRole, err = parseRole(p.MaxRole); err != nil {
+			return nil, fmt.Errorf("maxRole: %w", err)
+		}
+	}
+	return compiled, nil
+}
+
+// apply modifies claims in place, they must be a copy owned by the caller (see cloneClaims)
+func (p *claimsPolicy) apply(claims *authorization.Claims) {
+	claims.System = max(claims.System, p.grants.System)
+	for namespace, role := range p.grants.Namespaces {
+		claims.Namespaces[namespace] = max(claims.Namespaces[namespace], role)
+	}
+	if patterns := namespacePatterns(p.grants); len(patterns) > 0 {
+		ext := extensionsOf(claims)
+		ext.NamespacePatterns = append(ext.NamespacePatterns, patterns...)
+	}
+	for namespace, role := range p.force {
+		claims.Namespaces[namespace] = role
+	}
+	if p.maxRole == authorization.RoleUndefined {
+		return
+	}
+	claims.System = min(claims.System, p.maxRole)
+	for namespace, role := range claims.Namespaces {
+		claims.Namespaces[namespace] = min(role, p.maxRole)
+	}
+	patterns := namespacePatterns(claims)
+	for i := range patterns {
+		patterns[i].Role = min(patterns[i].Role, p.maxRole)
+	}
+}
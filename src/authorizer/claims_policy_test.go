@@ -0,0 +1,141 @@
+package authorizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+)
+
+func TestClaimMapperPolicy_Apply(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     ClaimMapperPolicy
+		claims     *authorization.Claims
+		system     authorization.Role
+		namespaces map[string]authorization.Role
+	}{
+		{
+			name:   "empty policy changes nothing",
+			policy: ClaimMapperPolicy{},
+			claims: &authorization.Claims{System: authorization.RoleReader, Namespaces: map[string]authorization.Role{"a": authorization.RoleWriter}},
+			system: authorization.RoleReader, namespaces: map[string]authorization.Role{"a": authorization.RoleWriter},
+		},
+		{
+			name:   "grants keep the highest role",
+			policy: ClaimMapperPolicy{Grants: RoleGrants{System: "read", Namespaces: map[string]string{"a": "read", "b": "write"}}},
+			claims: &authorization.Claims{Namespaces: map[string]authorization.Role{"a": authorization.RoleAdmin}},
+			system: authorization.RoleReader,
+			namespaces: map[string]authorization.Role{
+				"a": authorization.RoleAdmin,
+				"b": authorization.RoleWriter,
+			},
+		},
+		{
+			name:   "force overrides",
+			policy: ClaimMapperPolicy{Force: map[string]string{"prod": "read"}},
+			claims: &authorization.Claims{Namespaces: map[string]authorization.Role{"prod": authorization.RoleAdmin}},
+			system: authorization.RoleUndefined, namespaces: map[string]authorization.Role{"prod": authorization.RoleReader},
+		},
+		{
+			name: "max role caps grants and mapped roles",
+			policy: ClaimMapperPolicy{
+				Grants:  RoleGrants{Namespaces: map[string]string{"b": "admin"}},
+				MaxRole: "write",
+			},
+			claims: &authorization.Claims{System: authorization.RoleAdmin, Namespaces: map[string]authorization.Role{"a": authorization.RoleReader}},
+			system: authorization.RoleWriter,
+			namespaces: map[string]authorization.Role{
+				"a": authorization.RoleReader,
+				"b": authorization.RoleWriter,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := tc.policy.compile()
+			require.NoError(t, err)
+			policy.apply(tc.claims)
+			assert.Equal(t, tc.system, tc.claims.System)
+			assert.Equal(t, tc.namespaces, tc.claims.Namespaces)
+		})
+	}
+}
+
+func TestClaimMapperPolicy_ApplyPatternGrants(t *testing.T) {
+	policy, err := (&ClaimMapperPolicy{
+		Grants:  RoleGrants{Namespaces: map[string]string{"team-x-*": "write", "@all": "read", "@system": "admin"}},
+		MaxRole: "write",
+	}).compile()
+	require.NoError(t, err)
+	claims := &authorization.Claims{Namespaces: map[string]authorization.Role{}}
+	policy.apply(claims)
+	assert.Equal(t, authorization.RoleWriter, claims.System, "capped")
+	assert.Empty(t, claims.Namespaces, `"@all" is not a namespace name`)
+	assert.Equal(t, authorization.RoleWriter, namespacePatternRole(claims, "team-x-prod"))
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(claims, "orders"))
+}
+
+func TestClaimMapperPolicy_Invalid(t *testing.T) {
+	for name, policy := range map[string]ClaimMapperPolicy{
+		"grants.system":             {Grants: RoleGrants{System: "root"}},
+		"grants.namespaces.ns":      {Grants: RoleGrants{Namespaces: map[string]string{"ns": "root"}}},
+		"force.ns":                  {Force: map[string]string{"ns": ""}},
+		"force.@all":                {Force: map[string]string{"@all": "read"}},
+		"force.@system":             {Force: map[string]string{"@system": "read"}},
+		"force.team-*":              {Force: map[string]string{"team-*": "read"}},
+		"grants.namespaces./(/":     {Grants: RoleGrants{Namespaces: map[string]string{"/(/": "read"}}},
+		"grants.namespaces.@system": {Grants: RoleGrants{System: "read", Namespaces: map[string]string{"@system": "admin"}}},
+		"grants.namespaces.*":       {Grants: RoleGrants{Namespaces: map[string]string{"*": "read"}}},
+		"maxRole":                   {MaxRole: "root"},
+	} {
+		_, err := policy.compile()
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), name+":")
+	}
+}
+
+func TestMultiClaimMapper_NoImplicitEscalation(t *testing.T) {
+	jwtClaims := &authorization.Claims{Subject: "user", Namespaces: map[string]authorization.Role{"default": authorization.RoleReader}}
+	for _, name := range []string{"defaultJWTClaimMapper", "extraDataJWTClamMapper"} {
+		t.Run(name, func(t *testing.T) {
+			m := NewMultiClaimMapper(log.NewTestLogger())
+			m.Add(name, fakeMapper{claims: jwtClaims})
+
+			claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+			require.NoError(t, err)
+			assert.Equal(t, authorization.RoleUndefined, claims.System)
+			assert.Equal(t, map[string]authorization.Role{"default": authorization.RoleReader}, claims.Namespaces)
+		})
+	}
+}
+
+func TestMultiClaimMapper_Policy(t *testing.T) {
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.Add("jwt", fakeMapper{claims: &authorization.Claims{Subject: "user", Namespaces: map[string]authorization.Role{"default": authorization.RoleAdmin}}})
+	m.Add("none", fakeMapper{claims: &authorization.Claims{}})
+	require.NoError(t, m.SetPolicy("jwt", ClaimMapperPolicy{
+		Grants:  RoleGrants{Namespaces: map[string]string{"TestWorkflows": "admin"}},
+		MaxRole: "write",
+	}))
+	require.NoError(t, m.SetPolicy("none", ClaimMapperPolicy{Grants: RoleGrants{System: "admin"}}))
+	require.Error(t, m.SetPolicy("missing", ClaimMapperPolicy{}))
+	require.Error(t, m.SetPolicy("jwt", ClaimMapperPolicy{MaxRole: "root"}))
+
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]authorization.Role{
+		"default":       authorization.RoleWriter,
+		"TestWorkflows": authorization.RoleWriter,
+	}, claims.Namespaces)
+
+	// grants of a mapper apply only if it recognized the credentials
+	m = NewMultiClaimMapper(log.NewTestLogger())
+	m.Add("none", fakeMapper{claims: &authorization.Claims{}})
+	require.NoError(t, m.SetPolicy("none", ClaimMapperPolicy{Grants: RoleGrants{System: "admin"}}))
+	claims, err = m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.NoError(t, err)
+	assert.False(t, hasClaims(claims))
+}
@@ -0,0 +1,100 @@
+package authorizer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the authorization configuration file (YAML or JSON), TEMPORAL_AUTH_CONFIG_FILE.
+// Every section is optional and empty by default.
+type Config struct {
+	// ClaimMapperPolicies post-process the claims of a claim mapper, by claim mapper name
+	ClaimMapperPolicies map[string]ClaimMapperPolicy `yaml:"claimMapperPolicies"`
+	// AuthorizationRules allow or deny API calls before the default authorizer, first match wins
+	AuthorizationRules []AuthorizationRule `yaml:"authorizationRules"`
+	// SubjectRateLimit limits every subject without a rate limit of its own (e.g. JWT subjects), unlimited if nil
+	SubjectRateLimit *RateLimit `yaml:"subjectRateLimit"`
+	// Audit enables the audit log of authorization decisions
+	Audit *AuditConfig `yaml:"audit"`
+	// JWTCache caches the claims of verified JWTs, enabled with defaults if nil
+	JWTCache *JWTCacheConfig `yaml:"jwtCache"`
+	// JWTClaimMapping enables jwtRoleClaimMapper, which grants roles by the groups and roles of verified JWTs
+	JWTClaimMapping *JWTClaimMapping `yaml:"jwtClaimMapping"`
+	// JWTIssuers enables jwtIssuerClaimMapper, which verifies every token with the keys of its own issuer.
+	// JWTClaimMapping is then the claim mapping of issuers without one.
+	JWTIssuers []JWTIssuer `yaml:"jwtIssuers"`
+	// TLSClaimMapping enables tlsClaimMapper, which grants roles by the attributes of mTLS client certificates
+	TLSClaimMapping *TLSClaimMapping `yaml:"tlsClaimMapping"`
+	// SecondaryCredentials check a second credential in "Authorization-Extras" along with the primary one
+	SecondaryCredentials []SecondaryCredential `yaml:"secondaryCredentials"`
+}
+
+// LoadConfig reads and validates the authorization configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("auth config: %w", err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("auth config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(data []byte) (*Config, error) {
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for name, policy := range cfg.ClaimMapperPolicies {
+		if _, err := policy.compile(); err != nil {
+			return nil, fmt.Errorf("claimMapperPolicies.%s: %w", name, err)
+		}
+	}
+	for i := range cfg.AuthorizationRules {
+		if err := cfg.AuthorizationRules[i].validate(); err != nil {
+			return nil, fmt.Errorf("authorizationRules[%d]: %w", i, err)
+		}
+	}
+	if cfg.SubjectRateLimit != nil {
+		if err := cfg.SubjectRateLimit.validate(); err != nil {
+			return nil, fmt.Errorf("subjectRateLimit.%w", err)
+		}
+	}
+	if cfg.Audit != nil {
+		if err := cfg.Audit.validate(); err != nil {
+			return nil, fmt.Errorf("audit.%w", err)
+		}
+	}
+	if cfg.JWTCache != nil {
+		if err := cfg.JWTCache.validate(); err != nil {
+			return nil, fmt.Errorf("jwtCache.%w", err)
+		}
+	}
+	if cfg.JWTClaimMapping != nil {
+		if _, err := cfg.JWTClaimMapping.compile(); err != nil {
+			return nil, fmt.Errorf("jwtClaimMapping.%w", err)
+		}
+	}
+	if _, err := compileJWTIssuers(cfg.JWTIssuers, cfg.JWTClaimMapping); err != nil {
+		return nil, err
+	}
+	if cfg.TLSClaimMapping != nil {
+		if _, err := cfg.TLSClaimMapping.compile(); err != nil {
+			return nil, fmt.Errorf("tlsClaimMapping.%w", err)
+		}
+	}
+	if err := validateSecondaryCredentials(cfg.SecondaryCredentials); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,105 @@
+package authorizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+claimMapperPolicies:
+  defaultJWTClaimMapper:
+    grants:
+      namespaces:
+        TestWorkflows: admin
+    maxRole: write
+authorizationRules:
+  - name: no-terminate
+    subject: ci-*
+    api: "*Terminate*"
+    effect: deny
+`), 0o600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", cfg.ClaimMapperPolicies["defaultJWTClaimMapper"].Grants.Namespaces["TestWorkflows"])
+	assert.Equal(t, "write", cfg.ClaimMapperPolicies["defaultJWTClaimMapper"].MaxRole)
+	assert.Equal(t, []AuthorizationRule{{Name: "no-terminate", Subject: "ci-*", API: "*Terminate*", Effect: "deny"}}, cfg.AuthorizationRules)
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(nil)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.ClaimMapperPolicies)
+
+	_, err = parseConfig([]byte(`{"claimMapperPolicies": {"jwt": {"maxRole": "root"}}}`))
+	require.ErrorContains(t, err, `claimMapperPolicies.jwt: maxRole: unknown role "root"`)
+
+	_, err = parseConfig([]byte(`{"authorizationRules": [{"effect": "permit"}]}`))
+	require.ErrorContains(t, err, `authorizationRules[0]: effect:`)
+
+	_, err = parseConfig([]byte(`{"subjectRateLimit": {"rps": -1}}`))
+	require.ErrorContains(t, err, `subjectRateLimit.rps:`)
+
+	cfg, err = parseConfig([]byte(`{"subjectRateLimit": {"rps": 2.5}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &RateLimit{RPS: 2.5}, cfg.SubjectRateLimit)
+
+	_, err = parseConfig([]byte(`{"audit": {"sink": "kafka"}}`))
+	require.ErrorContains(t, err, `audit.sink:`)
+
+	cfg, err = parseConfig([]byte(`{"audit": {"sink": "file", "path": "/var/log/temporal/audit.jsonl"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &AuditConfig{Sink: "file", Path: "/var/log/temporal/audit.jsonl"}, cfg.Audit)
+
+	_, err = parseConfig([]byte(`{"jwtCache": {"ttl": "-1m"}}`))
+	require.ErrorContains(t, err, `jwtCache.ttl:`)
+
+	cfg, err = parseConfig([]byte("jwtCache:\n  ttl: 2m\n  negativeTTL: 1s\n"))
+	require.NoError(t, err)
+	assert.Equal(t, &JWTCacheConfig{TTL: 2 * time.Minute, NegativeTTL: time.Second}, cfg.JWTCache)
+
+	_, err = parseConfig([]byte(`{"jwtClaimMapping": {"rules": [{"value": "temporal-admins", "system": "root"}]}}`))
+	require.ErrorContains(t, err, `jwtClaimMapping.rules[0].system: unknown role "root"`)
+
+	cfg, err = parseConfig([]byte(`{"jwtClaimMapping": {"rules": [{"value": "team-x-devs", "namespaces": {"team-x-*": "write"}}]}}`))
+	require.NoError(t, err)
+	require.Len(t, cfg.JWTClaimMapping.Rules, 1)
+
+	_, err = parseConfig([]byte(`{"jwtIssuers": [{"issuer": "https://corp.example.com", "jwksURI": "https://corp.example.com/jwks"}]}`))
+	require.ErrorContains(t, err, `jwtIssuers[0].audience: required`)
+
+	cfg, err = parseConfig([]byte(`{
+		"jwtClaimMapping": {"rules": [{"value": "temporal-admins", "system": "admin"}]},
+		"jwtIssuers": [{"issuer": "https://corp.example.com", "jwksURI": "https://corp.example.com/jwks", "audience": "temporal", "clockSkew": "30s"}]
+	}`))
+	require.NoError(t, err)
+	require.Len(t, cfg.JWTIssuers, 1)
+	assert.Equal(t, 30*time.Second, cfg.JWTIssuers[0].ClockSkew)
+
+	_, err = parseConfig([]byte(`{"tlsClaimMapping": {"rules": [{"attribute": "serial", "value": "1", "system": "read"}]}}`))
+	require.ErrorContains(t, err, `tlsClaimMapping.rules[0].attribute: unknown attribute "serial"`)
+
+	cfg, err = parseConfig([]byte(`{"tlsClaimMapping": {"rules": [{"attribute": "spiffe", "value": "spiffe://example.org/worker/*", "namespaces": {"orders": "worker"}}]}}`))
+	require.NoError(t, err)
+	require.Len(t, cfg.TLSClaimMapping.Rules, 1)
+
+	_, err = parseConfig([]byte(`{"secondaryCredentials": [{"primary": "jwtIssuerClaimMapper", "secondary": "apiKeyFileClaimMapper", "require": "all"}]}`))
+	require.ErrorContains(t, err, `secondaryCredentials[0].require: unknown value "all"`)
+
+	cfg, err = parseConfig([]byte(`{"secondaryCredentials": [{"primary": "jwtIssuerClaimMapper", "secondary": "apiKeyFileClaimMapper"}]}`))
+	require.NoError(t, err)
+	require.Len(t, cfg.SecondaryCredentials, 1)
+
+	_, err = parseConfig([]byte(`{"policies": {}}`))
+	require.Error(t, err)
+}
@@ -1,42 +1,127 @@
 package authorizer
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
 
 	"go.temporal.io/server/common/authorization"
 	logpkg "go.temporal.io/server/common/log"
 )
 
+var (
+	// errNotJWT is data which is not a JWT at all, e.g. a host name with two dots
+	errNotJWT = errors.New("not a jwt")
+	// errMalformedJWT is a token with a JOSE header which cannot be verified
+	errMalformedJWT = errors.New("malformed jwt")
+
+	// defaultJWTAlgorithms are the algorithms of the default token key provider (RSA and EC keys from JWKS)
+	defaultJWTAlgorithms = []string{"RS256", "ES256"}
+)
+
 type extraDataJWTClamMapper struct {
 	defaultJWTClaimMapper authorization.ClaimMapper
+	algorithms            []string
 	logger                logpkg.Logger
 }
 
-// NewExtraDataJWTClamMapper using defaultJWTClaimMapper to check AuthInfo.ExtraData
-func NewExtraDataJWTClamMapper(defaultJWTClaimMapper authorization.ClaimMapper, logger logpkg.Logger) authorization.ClaimMapper {
-	return &extraDataJWTClamMapper{defaultJWTClaimMapper: defaultJWTClaimMapper, logger: logger}
+// NewExtraDataJWTClamMapper using defaultJWTClaimMapper to check AuthInfo.ExtraData.
+// NewSecondaryCredentialClaimMapper checks ExtraData with any claim mapper along with the AuthToken.
+// Only tokens signed with one of algorithms, RS256 and ES256 by default, are passed on; pass the SupportedMethods
+// of the token key provider.
+func NewExtraDataJWTClamMapper(defaultJWTClaimMapper authorization.ClaimMapper, logger logpkg.Logger, algorithms ...string) authorization.ClaimMapper {
+	if len(algorithms) == 0 {
+		algorithms = defaultJWTAlgorithms
+	}
+	return &extraDataJWTClamMapper{defaultJWTClaimMapper: defaultJWTClaimMapper, algorithms: algorithms, logger: logger}
 }
 
-// GetClaims check "Authorization-Extras" header if present
+// GetClaims check "Authorization-Extras" header if present.
+// Data which is not a JWT is skipped, a JWT with a header that cannot be verified returns errMalformedJWT.
 func (m *extraDataJWTClamMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
-	if authInfo != nil && looksLikeJWT(authInfo.ExtraData) {
-		authToken := authInfo.AuthToken
-		extraData := authInfo.ExtraData
-		// switch AuthToken<->ExtraData
-		alt := *authInfo
-		if strings.HasPrefix(strings.ToLower(extraData), authorizationBearer) {
-			alt.AuthToken = extraData
-		} else {
-			alt.AuthToken = authorizationBearer + " " + extraData
+	if authInfo == nil || authInfo.ExtraData == "" {
+		return nil, nil
+	}
+	extraData := authInfo.ExtraData
+	token := extraData
+	if scheme, rest, found := strings.Cut(extraData, " "); found && strings.EqualFold(scheme, authorizationBearer) {
+		token = rest
+	}
+	if _, err := parseJWTHeader(token, m.algorithms); err != nil {
+		if errors.Is(err, errNotJWT) {
+			m.logger.Debug("auth: extra data is not a jwt")
+			return nil, nil
 		}
-		alt.ExtraData = authToken
-		claims, err := m.defaultJWTClaimMapper.GetClaims(&alt)
-		return claims, err
+		return nil, err
 	}
-	return nil, nil
+
+	// switch AuthToken<->ExtraData
+	return m.defaultJWTClaimMapper.GetClaims(secondaryAuthInfo(authInfo))
+}
+
+// jwtHeader is the JOSE header of a JWS compact serialized JWT
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
 }
 
-func looksLikeJWT(t string) bool {
-	// very light check: three dot-separated parts
-	return strings.Count(t, ".") == 2
+// parseJWTHeader checks the structure of token: three base64url segments and a JSON object header.
+// Returns errNotJWT if token does not have this structure and errMalformedJWT if it does but the header
+// has no alg, an alg not in algorithms (never "none"), a typ other than JWT, or the signature is missing.
+// typ is optional (RFC 7519, section 5.1).
+func parseJWTHeader(token string, algorithms []string) (*jwtHeader, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errNotJWT
+	}
+	for _, segment := range segments {
+		if !isBase64URL(segment) {
+			return nil, errNotJWT
+		}
+	}
+	data, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return nil, errNotJWT
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errNotJWT
+	}
+
+	// from here on it is a JWT, just not one we can verify
+	var header jwtHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", errMalformedJWT, err)
+	}
+	switch {
+	case header.Alg == "":
+		return nil, fmt.Errorf("%w: no alg in header", errMalformedJWT)
+	case strings.EqualFold(header.Alg, "none") || !slices.Contains(algorithms, header.Alg):
+		return nil, fmt.Errorf("%w: alg %q not allowed, expected one of %s", errMalformedJWT, header.Alg, strings.Join(algorithms, ", "))
+	case header.Typ != "" && !isJWTType(header.Typ):
+		return nil, fmt.Errorf("%w: typ %q is not a jwt", errMalformedJWT, header.Typ)
+	case segments[1] == "" || segments[2] == "":
+		return nil, fmt.Errorf("%w: empty payload or signature", errMalformedJWT)
+	}
+	return &header, nil
+}
+
+// isJWTType accepts JWT and the access token type at+jwt (RFC 9068), with or without "application/"
+func isJWTType(typ string) bool {
+	typ = strings.TrimPrefix(strings.ToLower(typ), "application/")
+	return typ == "jwt" || typ == "at+jwt"
+}
+
+func isBase64URL(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
 }
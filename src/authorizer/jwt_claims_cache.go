@@ -0,0 +1,185 @@
+package authorizer
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.temporal.io/server/common/authorization"
+)
+
+const (
+	defaultJWTCacheSize        = 10000
+	defaultJWTCacheTTL         = 5 * time.Minute
+	defaultJWTCacheNegativeTTL = 5 * time.Second
+
+	jwtCacheHit         = "hit"
+	jwtCacheNegativeHit = "negative_hit"
+	jwtCacheMiss        = "miss"
+)
+
+// JWTCacheConfig configures the claims cache in front of the JWT claim mappers, enabled by default
+type JWTCacheConfig struct {
+	// Disabled verifies every token on every call
+	Disabled bool `yaml:"disabled"`
+	// Size is the number of cached tokens per claim mapper, 10000 by default
+	Size int `yaml:"size"`
+	// TTL caps how long verified claims are kept, the token "exp" cuts it short, 5m by default
+	TTL time.Duration `yaml:"ttl"`
+	// NegativeTTL is how long a rejected token stays rejected without verifying it again, 5s by default
+	NegativeTTL time.Duration `yaml:"negativeTTL"`
+}
+
+func (c *JWTCacheConfig) validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("size: must not be negative")
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("ttl: must not be negative")
+	}
+	if c.NegativeTTL < 0 {
+		return fmt.Errorf("negativeTTL: must not be negative")
+	}
+	return nil
+}
+
+type jwtCacheEntry struct {
+	claims    *authorization.Claims
+	err       error
+	expiresAt time.Time
+}
+
+type jwtClaimsCache struct {
+	// name of the cached claim mapper, the claim_mapper tag of the cache metrics
+	name        string
+	next        authorization.ClaimMapper
+	entries     *lru.Cache[[sha256.Size]byte, jwtCacheEntry]
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+	metrics     *AuthMetrics
+}
+
+// NewJWTClaimsCache caches the claims next returns for a token, keyed by a digest of the token and the audience.
+// Claims expire at the token "exp" or after the TTL, whichever comes first; errors are cached for the negative TTL
+// so a flood of forged tokens with the same value is not verified over and over. Tokens which are not JWTs (API keys,
+// garbage) and malformed JWTs are cheap to reject and never cached, so they cannot evict verified tokens.
+// Every cache holds up to cfg.Size tokens of its own claim mapper, claimMapperName labels its metrics.
+// Returns next if cfg is disabled.
+func NewJWTClaimsCache(claimMapperName string, next authorization.ClaimMapper, cfg JWTCacheConfig, authMetrics *AuthMetrics) (authorization.ClaimMapper, error) {
+	if cfg.Disabled {
+		return next, nil
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Size == 0 {
+		cfg.Size = defaultJWTCacheSize
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultJWTCacheTTL
+	}
+	if cfg.NegativeTTL == 0 {
+		cfg.NegativeTTL = defaultJWTCacheNegativeTTL
+	}
+	entries, err := lru.New[[sha256.Size]byte, jwtCacheEntry](cfg.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &jwtClaimsCache{
+		name:        claimMapperName,
+		next:        next,
+		entries:     entries,
+		ttl:         cfg.TTL,
+		negativeTTL: cfg.NegativeTTL,
+		now:         time.Now,
+		metrics:     authMetrics,
+	}, nil
+}
+
+// GetClaims returns cached claims or asks the next claim mapper, requests without a JWT are not cached
+func (c *jwtClaimsCache) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
+	if authInfo == nil {
+		return nil, nil
+	}
+	if authInfo.AuthToken == "" || !isJWT(authInfo.AuthToken) {
+		return c.next.GetClaims(authInfo)
+	}
+	// the audience is checked by the JWT claim mapper, the same token may be valid for one and not another
+	key := sha256.Sum256([]byte(authInfo.AuthToken + "\x00" + authInfo.Audience))
+	now := c.now()
+	if entry, ok := c.entries.Get(key); ok {
+		if now.Before(entry.expiresAt) {
+			if entry.err != nil {
+				c.metrics.jwtCacheLookup(c.name, jwtCacheNegativeHit)
+				return nil, entry.err
+			}
+			c.metrics.jwtCacheLookup(c.name, jwtCacheHit)
+			return cloneClaims(entry.claims), nil
+		}
+		c.entries.Remove(key)
+	}
+	c.metrics.jwtCacheLookup(c.name, jwtCacheMiss)
+
+	claims, err := c.next.GetClaims(authInfo)
+	switch {
+	case err != nil:
+		// a malformed JWT is rejected by its header, before any signature is verified
+		if !errors.Is(err, errMalformedJWT) && !errors.Is(err, errNotJWT) {
+			c.entries.Add(key, jwtCacheEntry{err: err, expiresAt: now.Add(c.negativeTTL)})
+		}
+		return nil, err
+	case claims == nil:
+		return nil, nil
+	}
+	expiresAt := now.Add(c.ttl)
+	if exp, ok := jwtExpiry(authInfo.AuthToken); ok && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+	if now.Before(expiresAt) {
+		c.entries.Add(key, jwtCacheEntry{claims: cloneClaims(claims), expiresAt: expiresAt})
+	}
+	return claims, nil
+}
+
+// isJWT reports whether a bearer token has the structure of a JWT, whether or not it can be verified
+func isJWT(authToken string) bool {
+	token := authToken
+	if scheme, rest, found := strings.Cut(authToken, " "); found && strings.EqualFold(scheme, authorizationBearer) {
+		token = rest
+	}
+	_, err := parseJWTHeader(token, nil)
+	return !errors.Is(err, errNotJWT)
+}
+
+// jwtExpiry reads the "exp" claim of a bearer token without verifying it, the claim mapper already did
+func jwtExpiry(authToken string) (time.Time, bool) {
+	token := authToken
+	if scheme, rest, found := strings.Cut(authToken, " "); found && strings.EqualFold(scheme, authorizationBearer) {
+		token = rest
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
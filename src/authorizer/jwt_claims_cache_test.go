@@ -0,0 +1,195 @@
+package authorizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/metrics/metricstest"
+)
+
+// countingMapper returns its claims or error and counts the calls
+type countingMapper struct {
+	fakeMapper
+	calls int
+}
+
+func (m *countingMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
+	m.calls++
+	return m.fakeMapper.GetClaims(authInfo)
+}
+
+// unsignedJWT is a token with the given payload, the cache never checks signatures
+func unsignedJWT(payload string) string {
+	enc := base64.RawURLEncoding
+	return "Bearer " + enc.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".c2ln"
+}
+
+func newTestJWTClaimsCache(t *testing.T, next authorization.ClaimMapper, cfg JWTCacheConfig, now *time.Time) *jwtClaimsCache {
+	t.Helper()
+	mapper, err := NewJWTClaimsCache("jwt", next, cfg, nil)
+	require.NoError(t, err)
+	cache := mapper.(*jwtClaimsCache)
+	cache.now = func() time.Time { return *now }
+	return cache
+}
+
+func TestJWTClaimsCache_Hit(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	next := &countingMapper{fakeMapper: fakeMapper{claims: &authorization.Claims{Subject: "alice", System: authorization.RoleReader}}}
+	cache := newTestJWTClaimsCache(t, next, JWTCacheConfig{TTL: time.Minute}, &now)
+	token := unsignedJWT(`{"sub":"alice"}`)
+
+	claims, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+	require.NoError(t, err)
+	claims.System = authorization.RoleAdmin // callers may change the claims they get
+
+	claims, err = cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Subject)
+	assert.Equal(t, authorization.RoleReader, claims.System)
+	assert.Equal(t, 1, next.calls)
+
+	// same token, different audience
+	_, err = cache.GetClaims(&authorization.AuthInfo{AuthToken: token, Audience: "other"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, next.calls)
+
+	now = now.Add(time.Minute)
+	_, err = cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+	require.NoError(t, err)
+	assert.Equal(t, 3, next.calls, "expired after the TTL")
+}
+
+func TestJWTClaimsCache_TokenExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	next := &countingMapper{fakeMapper: fakeMapper{claims: &authorization.Claims{Subject: "alice"}}}
+	cache := newTestJWTClaimsCache(t, next, JWTCacheConfig{TTL: time.Hour}, &now)
+	token := unsignedJWT(fmt.Sprintf(`{"sub":"alice","exp":%d}`, now.Add(10*time.Second).Unix()))
+
+	for range 2 {
+		_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, next.calls)
+
+	now = now.Add(10 * time.Second)
+	_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+	require.NoError(t, err)
+	assert.Equal(t, 2, next.calls, "the token expired before the TTL")
+}
+
+func TestJWTClaimsCache_Negative(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	next := &countingMapper{fakeMapper: fakeMapper{err: serviceerror.NewPermissionDenied("token signature is invalid", "")}}
+	cache := newTestJWTClaimsCache(t, next, JWTCacheConfig{NegativeTTL: 2 * time.Second}, &now)
+	token := unsignedJWT(`{"sub":"mallory"}`)
+
+	for range 3 {
+		_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.ErrorContains(t, err, "token signature is invalid")
+	}
+	assert.Equal(t, 1, next.calls)
+
+	now = now.Add(2 * time.Second)
+	_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+	require.Error(t, err)
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestJWTClaimsCache_NotJWT(t *testing.T) {
+	now := time.Now()
+	next := &countingMapper{fakeMapper: fakeMapper{err: serviceerror.NewPermissionDenied("token contains an invalid number of segments", "")}}
+	cache := newTestJWTClaimsCache(t, next, JWTCacheConfig{Size: 1}, &now)
+
+	// API keys and garbage are passed on every time and never take the place of a cached token
+	for _, token := range []string{"Bearer ci-bot.s3cret", "Bearer tmprl_ci-bot_s3cret_abcd", "Bearer a.b.c", "Basic dXNlcjpwYXNz"} {
+		for range 2 {
+			_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: token})
+			require.Error(t, err, token)
+		}
+	}
+	assert.Equal(t, 8, next.calls)
+	assert.Zero(t, cache.entries.Len())
+
+	// malformed JWTs are rejected by their header, not cached either
+	next.err = fmt.Errorf("%w: alg %q not allowed", errMalformedJWT, "HS256")
+	_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: unsignedJWT(`{"sub":"mallory"}`)})
+	require.ErrorIs(t, err, errMalformedJWT)
+	assert.Zero(t, cache.entries.Len())
+}
+
+func TestJWTClaimsCache_NoToken(t *testing.T) {
+	now := time.Now()
+	next := &countingMapper{fakeMapper: fakeMapper{claims: &authorization.Claims{}}}
+	cache := newTestJWTClaimsCache(t, next, JWTCacheConfig{}, &now)
+	for range 2 {
+		_, err := cache.GetClaims(&authorization.AuthInfo{})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, next.calls)
+
+	// the default JWT claim mapper dereferences authInfo
+	claims, err := cache.GetClaims(nil)
+	require.NoError(t, err)
+	assert.Nil(t, claims)
+	assert.Equal(t, 2, next.calls)
+}
+
+func TestJWTClaimsCache_Size(t *testing.T) {
+	now := time.Now()
+	next := &countingMapper{fakeMapper: fakeMapper{claims: &authorization.Claims{Subject: "alice"}}}
+	cache := newTestJWTClaimsCache(t, next, JWTCacheConfig{Size: 2}, &now)
+	for _, sub := range []string{"a", "b", "c", "a"} {
+		_, err := cache.GetClaims(&authorization.AuthInfo{AuthToken: unsignedJWT(`{"sub":"` + sub + `"}`)})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, next.calls, "a was evicted by c")
+}
+
+func TestJWTClaimsCache_Disabled(t *testing.T) {
+	next := &countingMapper{}
+	mapper, err := NewJWTClaimsCache("jwt", next, JWTCacheConfig{Disabled: true}, nil)
+	require.NoError(t, err)
+	assert.Same(t, next, mapper)
+
+	_, err = NewJWTClaimsCache("jwt", next, JWTCacheConfig{NegativeTTL: -time.Second}, nil)
+	require.ErrorContains(t, err, "negativeTTL:")
+}
+
+func TestJWTClaimsCache_Metrics(t *testing.T) {
+	handler := metricstest.NewCaptureHandler()
+	capture := handler.StartCapture()
+	defer handler.StopCapture(capture)
+
+	mapper, err := NewJWTClaimsCache("jwtRoleClaimMapper", fakeMapper{claims: &authorization.Claims{Subject: "alice"}}, JWTCacheConfig{}, NewAuthMetrics(handler))
+	require.NoError(t, err)
+	for range 2 {
+		_, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: unsignedJWT(`{"sub":"alice"}`)})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []map[string]string{
+		{"claim_mapper": "jwtRoleClaimMapper", "result": "miss"},
+		{"claim_mapper": "jwtRoleClaimMapper", "result": "hit"},
+	}, recordedTags(t, capture, "auth_jwt_cache_requests"))
+}
+
+func TestJWTExpiry(t *testing.T) {
+	exp, ok := jwtExpiry(unsignedJWT(`{"exp":1740830400}`))
+	require.True(t, ok)
+	assert.Equal(t, int64(1740830400), exp.Unix())
+
+	exp, ok = jwtExpiry(unsignedJWT(`{"exp":1740830400.5}`)[len("Bearer "):])
+	require.True(t, ok)
+	assert.Equal(t, int64(1740830400), exp.Unix())
+
+	for _, token := range []string{"", "Bearer ci-bot.s3cret", unsignedJWT(`{"sub":"alice"}`), unsignedJWT(`{"exp":"soon"}`), "Bearer a.!!.c"} {
+		_, ok := jwtExpiry(token)
+		assert.False(t, ok, token)
+	}
+}
@@ -0,0 +1,170 @@
+package authorizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+)
+
+type (
+	// JWTIssuer is a trusted identity provider, tokens are only verified with the keys of their own issuer
+	JWTIssuer struct {
+		// Issuer is the exact "iss" claim of the tokens
+		Issuer string `yaml:"issuer"`
+		// JWKSURI serves the signing keys of the issuer
+		JWKSURI string `yaml:"jwksURI"`
+		// RefreshInterval re-fetches the keys, they are only fetched at startup if 0
+		RefreshInterval time.Duration `yaml:"refreshInterval"`
+		// Audience the "aud" claim must contain
+		Audience string `yaml:"audience"`
+		// ClockSkew is tolerated when checking exp, nbf and iat
+		ClockSkew time.Duration `yaml:"clockSkew"`
+		// ClaimMapping grants roles for the groups and roles of the issuer's tokens, jwtClaimMapping if nil
+		ClaimMapping *JWTClaimMapping `yaml:"claimMapping"`
+		// MaxRole caps every role granted to the issuer's tokens
+		MaxRole string `yaml:"maxRole"`
+	}
+
+	// jwtIssuer is the validated JWTIssuer
+	jwtIssuer struct {
+		issuer          string
+		keyProvider     authorization.TokenKeyProvider
+		jwksURI         string
+		refreshInterval time.Duration
+		audience        string
+		clockSkew       time.Duration
+		mapping         *jwtRoleMapping
+		// policy caps the roles at MaxRole, nil without one
+		policy *claimsPolicy
+	}
+
+	jwtIssuerClaimMapper struct {
+		issuers map[string]*jwtIssuer
+		logger  logpkg.Logger
+	}
+)
+
+// compileJWTIssuers validates the issuers, defaultMapping is used by issuers without a claim mapping of their own
+func compileJWTIssuers(issuers []JWTIssuer, defaultMapping *JWTClaimMapping) (map[string]*jwtIssuer, error) {
+	compiled := make(map[string]*jwtIssuer, len(issuers))
+	for i := range issuers {
+		issuer, err := issuers[i].compile(defaultMapping)
+		if err != nil {
+			return nil, fmt.Errorf("jwtIssuers[%d].%w", i, err)
+		}
+		if _, ok := compiled[issuer.issuer]; ok {
+			return nil, fmt.Errorf("jwtIssuers[%d].issuer: %q is configured twice", i, issuer.issuer)
+		}
+		compiled[issuer.issuer] = issuer
+	}
+	return compiled, nil
+}
+
+func (i *JWTIssuer) compile(defaultMapping *JWTClaimMapping) (*jwtIssuer, error) {
+	if i.Issuer == "" {
+		return nil, fmt.Errorf("issuer: required")
+	}
+	if u, err := url.Parse(i.JWKSURI); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("jwksURI: expected an http(s) URL, got %q", i.JWKSURI)
+	}
+	if i.Audience == "" {
+		return nil, fmt.Errorf("audience: required, tokens issued for other applications must not be accepted")
+	}
+	if i.ClockSkew < 0 {
+		return nil, fmt.Errorf("clockSkew: must not be negative")
+	}
+	if i.RefreshInterval < 0 {
+		return nil, fmt.Errorf("refreshInterval: must not be negative")
+	}
+	mapping := i.ClaimMapping
+	if mapping == nil {
+		mapping = defaultMapping
+	}
+	if mapping == nil {
+		return nil, fmt.Errorf("claimMapping: required without jwtClaimMapping")
+	}
+	compiled := &jwtIssuer{issuer: i.Issuer, jwksURI: i.JWKSURI, refreshInterval: i.RefreshInterval, audience: i.Audience, clockSkew: i.ClockSkew}
+	var err error
+	if compiled.mapping, err = mapping.compile(); err != nil {
+		return nil, fmt.Errorf("claimMapping.%w", err)
+	}
+	if i.MaxRole != "" {
+		policy := ClaimMapperPolicy{MaxRole: i.MaxRole}
+		if compiled.policy, err = policy.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return compiled, nil
+}
+
+// NewJWTIssuerClaimMapper creates a claim mapper which picks the issuer by the "iss" claim of the token and
+// verifies the token with the keys fetched from the JWKS URI of that issuer only. Tokens of other issuers are skipped.
+func NewJWTIssuerClaimMapper(keyProvider *JWTIssuerKeyProvider, logger logpkg.Logger) authorization.ClaimMapper {
+	return &jwtIssuerClaimMapper{issuers: keyProvider.issuers, logger: logger}
+}
+
+// GetClaims verifies the token with the keys and audience of its issuer and maps its roles
+func (m *jwtIssuerClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
+	if authInfo == nil || authInfo.AuthToken == "" {
+		return nil, nil
+	}
+	scheme, token, found := strings.Cut(authInfo.AuthToken, " ")
+	if !found || !strings.EqualFold(scheme, authorizationBearer) {
+		return nil, nil
+	}
+	// the signature is checked with the keys of this issuer only, a forged "iss" cannot pick other keys
+	issuerName := unverifiedJWTIssuer(token)
+	issuer, ok := m.issuers[issuerName]
+	if !ok {
+		m.logger.Debug("auth: jwt of an unknown issuer", tag.NewStringTag("issuer", issuerName))
+		return nil, nil
+	}
+	if _, err := parseJWTHeader(token, issuer.keyProvider.SupportedMethods()); err != nil {
+		if errors.Is(err, errNotJWT) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	jwtClaims, err := verifyJWT(token, issuer.keyProvider, issuer.audience, issuer.clockSkew)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := issuer.mapping.apply(jwtClaims)
+	if err != nil {
+		return nil, err
+	}
+	if issuer.policy != nil {
+		issuer.policy.apply(claims)
+	}
+	m.logger.Debug("auth: jwt roles mapped", tag.NewStringTag("issuer", issuer.issuer), tag.NewStringTag("subject", claims.Subject),
+		tag.NewStringTag("claims", fmt.Sprintf("sys:%v,ns:%v", claims.System, claims.Namespaces)))
+	return claims, nil
+}
+
+// unverifiedJWTIssuer reads the "iss" claim without verifying the token or looking at its header
+func unverifiedJWTIssuer(token string) string {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(segments[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
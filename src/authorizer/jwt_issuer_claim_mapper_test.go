@@ -0,0 +1,196 @@
+package authorizer
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+)
+
+// newTestJWKSServer serves the public keys by kid as a JWKS document
+func newTestJWKSServer(t *testing.T, keys map[string]*rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	enc := base64.RawURLEncoding
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		jwks.Keys = append(jwks.Keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   enc.EncodeToString(key.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJWTIssuerClaimMapper_GetClaims(t *testing.T) {
+	corpKey, partnerKey := newTestRSAKey(t), newTestRSAKey(t)
+	corpJWKS := newTestJWKSServer(t, map[string]*rsa.PrivateKey{"corp-1": corpKey})
+	partnerJWKS := newTestJWKSServer(t, map[string]*rsa.PrivateKey{"partner-1": partnerKey})
+
+	mapping := &JWTClaimMapping{Rules: []JWTClaimRule{
+		{Value: "temporal-admins", System: "admin"},
+		{Value: "team-x-devs", Namespaces: map[string]string{"team-x-*": "write", "shared": "admin"}},
+	}}
+	keyProvider, err := NewJWTIssuerKeyProvider([]JWTIssuer{
+		{Issuer: "https://corp.example.com", JWKSURI: corpJWKS.URL, Audience: "temporal", ClockSkew: 30 * time.Second},
+		{
+			Issuer:   "https://partner.example.com",
+			JWKSURI:  partnerJWKS.URL,
+			Audience: "temporal-partner",
+			MaxRole:  "read",
+			ClaimMapping: &JWTClaimMapping{Claims: []string{"roles"}, Rules: []JWTClaimRule{
+				{Value: "TemporalAdmin", System: "admin"},
+				{Value: "TeamX", Namespaces: map[string]string{"team-x-*": "write"}},
+			}},
+		},
+	}, mapping, log.NewTestLogger())
+	require.NoError(t, err)
+	mapper := NewJWTIssuerClaimMapper(keyProvider, log.NewTestLogger())
+
+	now := time.Now()
+	corpClaims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": "https://corp.example.com", "aud": "temporal", "sub": "alice", "exp": now.Add(time.Hour).Unix()}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	partnerClaims := jwt.MapClaims{"iss": "https://partner.example.com", "aud": "temporal-partner", "sub": "pat", "exp": now.Add(time.Hour).Unix(),
+		"roles": []string{"TemporalAdmin", "TeamX"}}
+
+	t.Run("corp", func(t *testing.T) {
+		token := signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"groups": []string{"temporal-admins", "team-x-devs"}}))
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", claims.Subject)
+		assert.Equal(t, authorization.RoleAdmin, claims.System)
+		assert.Equal(t, authorization.RoleAdmin, claims.Namespaces["shared"])
+		assert.Equal(t, authorization.RoleWriter, namespacePatternRole(claims, "team-x-prod"))
+	})
+
+	t.Run("partner capped at max role", func(t *testing.T) {
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: signTestJWT(t, partnerKey, "partner-1", partnerClaims)})
+		require.NoError(t, err)
+		assert.Equal(t, "pat", claims.Subject)
+		assert.Equal(t, authorization.RoleReader, claims.System)
+		assert.Equal(t, authorization.RoleReader, namespacePatternRole(claims, "team-x-prod"))
+	})
+
+	t.Run("clock skew", func(t *testing.T) {
+		token := signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix(), "groups": []string{"temporal-admins"}}))
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Equal(t, authorization.RoleAdmin, claims.System)
+
+		token = signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}))
+		_, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.ErrorContains(t, err, "token is expired")
+
+		// the partner tolerates no skew
+		expired := jwt.MapClaims{}
+		for k, v := range partnerClaims {
+			expired[k] = v
+		}
+		expired["exp"] = now.Add(-10 * time.Second).Unix()
+		_, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: signTestJWT(t, partnerKey, "partner-1", expired)})
+		require.ErrorContains(t, err, "token is expired")
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			token   string
+			wantErr string
+		}{
+			// a partner key must not sign corp tokens, even with the partner kid
+			{"claims another issuer", signTestJWT(t, partnerKey, "partner-1", corpClaims(jwt.MapClaims{"groups": []string{"temporal-admins"}})), "RSA key not found for key ID: partner-1"},
+			{"forged kid", signTestJWT(t, partnerKey, "corp-1", corpClaims(jwt.MapClaims{"groups": []string{"temporal-admins"}})), "verification error"},
+			{"audience of another issuer", signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"aud": "temporal-partner"})), "audience mismatch"},
+			{"no audience", signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"aud": nil})), "audience mismatch"},
+			{"algorithm of no issuer key", hmacTestJWT(t, corpClaims(jwt.MapClaims{"groups": []string{"temporal-admins"}})), `alg "HS256" not allowed`},
+			{"not yet valid", signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()})), "token is not valid yet"},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: tc.token})
+				require.ErrorContains(t, err, tc.wantErr)
+				assert.Nil(t, claims)
+			})
+		}
+	})
+
+	t.Run("unknown issuer skipped", func(t *testing.T) {
+		token := signTestJWT(t, corpKey, "corp-1", corpClaims(jwt.MapClaims{"iss": "https://evil.example.com"}))
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Nil(t, claims)
+
+		claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.s3cret"})
+		require.NoError(t, err)
+		assert.Nil(t, claims)
+	})
+}
+
+// hmacTestJWT signs claims with a shared secret, which no JWKS issuer key provider accepts
+func hmacTestJWT(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("s3cret"))
+	require.NoError(t, err)
+	return "Bearer " + signed
+}
+
+func TestCompileJWTIssuers(t *testing.T) {
+	mapping := &JWTClaimMapping{Rules: []JWTClaimRule{{Value: "temporal-admins", System: "admin"}}}
+	valid := JWTIssuer{Issuer: "https://corp.example.com", JWKSURI: "https://corp.example.com/jwks", Audience: "temporal"}
+	with := func(change func(*JWTIssuer)) []JWTIssuer {
+		issuer := valid
+		change(&issuer)
+		return []JWTIssuer{issuer}
+	}
+
+	tests := []struct {
+		name           string
+		issuers        []JWTIssuer
+		defaultMapping *JWTClaimMapping
+		wantErr        string
+	}{
+		{"no issuer", with(func(i *JWTIssuer) { i.Issuer = "" }), mapping, "jwtIssuers[0].issuer: required"},
+		{"jwks not a url", with(func(i *JWTIssuer) { i.JWKSURI = "/etc/jwks.json" }), mapping, "jwtIssuers[0].jwksURI:"},
+		{"no audience", with(func(i *JWTIssuer) { i.Audience = "" }), mapping, "jwtIssuers[0].audience: required"},
+		{"negative skew", with(func(i *JWTIssuer) { i.ClockSkew = -time.Second }), mapping, "jwtIssuers[0].clockSkew:"},
+		{"no mapping", []JWTIssuer{valid}, nil, "jwtIssuers[0].claimMapping: required without jwtClaimMapping"},
+		{"bad mapping", with(func(i *JWTIssuer) { i.ClaimMapping = &JWTClaimMapping{} }), mapping, "jwtIssuers[0].claimMapping.rules:"},
+		{"bad max role", with(func(i *JWTIssuer) { i.MaxRole = "root" }), mapping, `jwtIssuers[0].maxRole: unknown role "root"`},
+		{"duplicate", []JWTIssuer{valid, valid}, mapping, `jwtIssuers[1].issuer: "https://corp.example.com" is configured twice`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := compileJWTIssuers(tc.issuers, tc.defaultMapping)
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	issuers, err := compileJWTIssuers(with(func(i *JWTIssuer) { i.MaxRole = "write" }), mapping)
+	require.NoError(t, err)
+	assert.Equal(t, authorization.RoleWriter, issuers["https://corp.example.com"].policy.maxRole)
+}
@@ -0,0 +1,70 @@
+package authorizer
+
+import (
+	"fmt"
+	"strings"
+
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/config"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+)
+
+// JWTIssuerKeyProvider holds the keys of every trusted issuer, a token is only verified with the keys of its own
+// issuer, picked by the "iss" claim, so keys of one identity provider cannot sign tokens of another.
+// It is not a token key provider of the default JWT claim mapper: that mapper grants the permissions claim as is,
+// without the claim mapping, maxRole and clockSkew of the issuer.
+type JWTIssuerKeyProvider struct {
+	issuers map[string]*jwtIssuer
+}
+
+// NewJWTIssuerKeyProvider fetches the keys of every issuer from its JWKS URI.
+// defaultMapping is used by issuers without a claim mapping of their own, see NewJWTIssuerClaimMapper.
+func NewJWTIssuerKeyProvider(issuers []JWTIssuer, defaultMapping *JWTClaimMapping, logger logpkg.Logger) (*JWTIssuerKeyProvider, error) {
+	compiled, err := compileJWTIssuers(issuers, defaultMapping)
+	if err != nil {
+		return nil, err
+	}
+	for i := range issuers {
+		issuer := compiled[issuers[i].Issuer]
+		issuer.keyProvider = authorization.NewDefaultTokenKeyProvider(&config.Authorization{
+			JWTKeyProvider: config.JWTKeyProvider{
+				KeySourceURIs:   []string{issuers[i].JWKSURI},
+				RefreshInterval: issuers[i].RefreshInterval,
+			},
+		}, logger)
+		logger.Info("auth: jwt issuer registered", tag.NewStringTag("issuer", issuer.issuer),
+			tag.NewStringTag("audience", issuer.audience))
+	}
+	return &JWTIssuerKeyProvider{issuers: compiled}, nil
+}
+
+// CheckKeySources fails if the JWKS URI of an issuer is also a key source of the default token key provider,
+// global.authorization.jwtKeyProvider.keySourceURIs. The default JWT claim mappers would then verify the issuer's tokens
+// and grant their permissions claim without the audience, clockSkew, claim mapping and maxRole of the issuer.
+func (p *JWTIssuerKeyProvider) CheckKeySources(keySourceURIs []string) error {
+	sources := make(map[string]bool, len(keySourceURIs))
+	for _, uri := range keySourceURIs {
+		sources[normalizeKeySourceURI(uri)] = true
+	}
+	for _, issuer := range p.issuers {
+		if sources[normalizeKeySourceURI(issuer.jwksURI)] {
+			return fmt.Errorf("issuer %q: jwksURI %s is also in global.authorization.jwtKeyProvider.keySourceURIs", issuer.issuer, issuer.jwksURI)
+		}
+	}
+	return nil
+}
+
+func normalizeKeySourceURI(uri string) string {
+	return strings.TrimRight(strings.TrimSpace(uri), "/")
+}
+
+// Close stops refreshing the keys
+func (p *JWTIssuerKeyProvider) Close() {
+	for _, issuer := range p.issuers {
+		// the default token key provider only has a refresh loop to stop with a refresh interval
+		if issuer.refreshInterval > 0 {
+			issuer.keyProvider.Close()
+		}
+	}
+}
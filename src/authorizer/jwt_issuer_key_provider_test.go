@@ -0,0 +1,59 @@
+package authorizer
+
+import (
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/log"
+)
+
+func TestJWTIssuerKeyProvider_MaxRoleWithDefaultJWTClaimMapper(t *testing.T) {
+	logger := log.NewTestLogger()
+	corpKey, partnerKey := newTestRSAKey(t), newTestRSAKey(t)
+	corpJWKS := newTestJWKSServer(t, map[string]*rsa.PrivateKey{"corp-1": corpKey})
+	partnerJWKS := newTestJWKSServer(t, map[string]*rsa.PrivateKey{"partner-1": partnerKey})
+
+	keyProvider, err := NewJWTIssuerKeyProvider([]JWTIssuer{
+		{Issuer: "https://partner.example.com", JWKSURI: partnerJWKS.URL, Audience: "temporal-partner", MaxRole: "read"},
+	}, &JWTClaimMapping{Rules: []JWTClaimRule{{Value: "temporal-admins", System: "admin"}}}, logger)
+	require.NoError(t, err)
+	defer keyProvider.Close()
+
+	// the default JWT claim mapper keeps the keys of keySourceURIs and is asked first
+	authCfg := &config.Authorization{JWTKeyProvider: config.JWTKeyProvider{KeySourceURIs: []string{corpJWKS.URL}}}
+	m := NewMultiClaimMapper(logger)
+	m.Add("defaultJWTClaimMapper", authorization.NewDefaultJWTClaimMapper(authorization.NewDefaultTokenKeyProvider(authCfg, logger), authCfg, logger))
+	m.Add("jwtIssuerClaimMapper", NewJWTIssuerClaimMapper(keyProvider, logger))
+
+	token := signTestJWT(t, partnerKey, "partner-1", jwt.MapClaims{
+		"iss": "https://partner.example.com", "aud": "temporal-partner", "sub": "pat", "exp": time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"temporal-admins"}, "permissions": []string{"temporal-system:admin", "orders:admin"},
+	})
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: token})
+	require.NoError(t, err)
+	assert.Equal(t, "pat", claims.Subject)
+	assert.Equal(t, authorization.RoleReader, claims.System)
+	assert.Empty(t, claims.Namespaces, "the permissions claim is not granted")
+}
+
+func TestJWTIssuerKeyProvider_CheckKeySources(t *testing.T) {
+	logger := log.NewTestLogger()
+	partnerJWKS := newTestJWKSServer(t, map[string]*rsa.PrivateKey{"partner-1": newTestRSAKey(t)})
+
+	keyProvider, err := NewJWTIssuerKeyProvider([]JWTIssuer{
+		{Issuer: "https://partner.example.com", JWKSURI: partnerJWKS.URL + "/", Audience: "temporal-partner"},
+	}, &JWTClaimMapping{Rules: []JWTClaimRule{{Value: "temporal-admins", System: "admin"}}}, logger)
+	require.NoError(t, err)
+	defer keyProvider.Close()
+
+	require.NoError(t, keyProvider.CheckKeySources(nil))
+	require.NoError(t, keyProvider.CheckKeySources([]string{"https://corp.example.com/jwks"}))
+	require.ErrorContains(t, keyProvider.CheckKeySources([]string{"https://corp.example.com/jwks", partnerJWKS.URL}),
+		`issuer "https://partner.example.com": jwksURI`)
+}
@@ -0,0 +1,216 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+)
+
+// defaultJWTRoleClaims are the claims most identity providers put group and role names in
+var defaultJWTRoleClaims = []string{"groups", "roles"}
+
+type (
+	// JWTClaimMapping maps group and role names of verified JWTs to Temporal roles
+	JWTClaimMapping struct {
+		// Claims hold group or role names, a string or a list of strings; a dotted path reaches nested claims,
+		// e.g. "realm_access.roles" for Keycloak realm roles. Default "groups" and "roles".
+		Claims []string `yaml:"claims"`
+		// Rules are all checked, the highest role per namespace wins
+		Rules []JWTClaimRule `yaml:"rules"`
+	}
+
+	// JWTClaimRule grants roles to tokens with a matching claim value
+	JWTClaimRule struct {
+		// Claim restricts the rule to one of the mapped claims, any of them if empty
+		Claim string `yaml:"claim"`
+		// Value is a group or role name, a glob ("*" any characters, "?" one character)
+		Value string `yaml:"value"`
+		// System is the system role granted
+		System string `yaml:"system"`
+		// Namespaces maps namespaces to roles, a namespace may be a glob, an anchored /regex/ or "@all"
+		Namespaces map[string]string `yaml:"namespaces"`
+	}
+
+	// jwtRoleMapping is the validated JWTClaimMapping
+	jwtRoleMapping struct {
+		claims []string
+		rules  []roleRule
+	}
+
+	jwtRoleClaimMapper struct {
+		keyProvider authorization.TokenKeyProvider
+		mapping     *jwtRoleMapping
+		logger      logpkg.Logger
+	}
+)
+
+func (m *JWTClaimMapping) compile() (*jwtRoleMapping, error) {
+	claims := m.Claims
+	if len(claims) == 0 {
+		claims = defaultJWTRoleClaims
+	}
+	if len(m.Rules) == 0 {
+		return nil, fmt.Errorf("rules: at least one rule is required")
+	}
+	rules := make([]roleRule, 0, len(m.Rules))
+	for i, r := range m.Rules {
+		rule, err := r.compile(claims)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d].%w", i, err)
+		}
+		rules = append(rules, *rule)
+	}
+	return &jwtRoleMapping{claims: claims, rules: rules}, nil
+}
+
+func (r *JWTClaimRule) compile(claims []string) (*roleRule, error) {
+	if r.Claim != "" && !slices.Contains(claims, r.Claim) {
+		return nil, fmt.Errorf("claim: %q is not one of the mapped claims %s", r.Claim, strings.Join(claims, ", "))
+	}
+	return newRoleRule(r.Claim, r.Value, r.System, r.Namespaces)
+}
+
+// NewJWTRoleClaimMapper creates a claim mapper which verifies bearer JWTs with keyProvider, like the default
+// JWT claim mapper, and grants roles by the group and role names in the token according to mapping.
+func NewJWTRoleClaimMapper(keyProvider authorization.TokenKeyProvider, mapping JWTClaimMapping, logger logpkg.Logger) (authorization.ClaimMapper, error) {
+	compiled, err := mapping.compile()
+	if err != nil {
+		return nil, err
+	}
+	return &jwtRoleClaimMapper{keyProvider: keyProvider, mapping: compiled, logger: logger}, nil
+}
+
+// GetClaims verifies the token and applies every matching rule.
+// Requests without a bearer JWT are skipped, a token no rule matches yields claims without roles.
+func (m *jwtRoleClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
+	if authInfo == nil || authInfo.AuthToken == "" {
+		return nil, nil
+	}
+	scheme, token, found := strings.Cut(authInfo.AuthToken, " ")
+	if !found || !strings.EqualFold(scheme, authorizationBearer) {
+		return nil, nil
+	}
+	if _, err := parseJWTHeader(token, m.keyProvider.SupportedMethods()); err != nil {
+		if errors.Is(err, errNotJWT) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	jwtClaims, err := verifyJWT(token, m.keyProvider, authInfo.Audience, 0)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := m.mapping.apply(jwtClaims)
+	if err != nil {
+		return nil, err
+	}
+	m.logger.Debug("auth: jwt roles mapped", tag.NewStringTag("subject", claims.Subject),
+		tag.NewStringTag("claims", fmt.Sprintf("sys:%v,ns:%v", claims.System, claims.Namespaces)))
+	return claims, nil
+}
+
+// apply grants the roles of every rule matching a value of the verified jwtClaims
+func (m *jwtRoleMapping) apply(jwtClaims jwt.MapClaims) (*authorization.Claims, error) {
+	subject, ok := jwtClaims["sub"].(string)
+	if !ok {
+		return nil, serviceerror.NewPermissionDenied(`unexpected value type of "sub" claim`, "")
+	}
+	claims := &authorization.Claims{Subject: subject, Namespaces: make(map[string]authorization.Role)}
+	for _, name := range m.claims {
+		for _, value := range jwtClaimValues(jwtClaims, name) {
+			for i := range m.rules {
+				if m.rules[i].matches(name, value) {
+					m.rules[i].grant(claims)
+				}
+			}
+		}
+	}
+	return claims, nil
+}
+
+// jwtClaimValues returns the string values of a claim, path is split at dots into nested objects
+func jwtClaimValues(claims jwt.MapClaims, path string) []string {
+	var value any = map[string]any(claims)
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if value, ok = object[key]; !ok {
+			return nil
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// verifyJWT checks signature, expiry and audience the way the default JWT claim mapper does,
+// exp, nbf and iat are checked with clockSkew tolerance
+func verifyJWT(token string, keyProvider authorization.TokenKeyProvider, audience string, clockSkew time.Duration) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(keyProvider.SupportedMethods()), jwt.WithoutClaimsValidation())
+	keyFunc := func(t *jwt.Token) (any, error) {
+		return tokenKey(keyProvider, t)
+	}
+	parsed, err := parser.Parse(token, keyFunc)
+	if err != nil {
+		return nil, serviceerror.NewPermissionDenied(err.Error(), "")
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, serviceerror.NewPermissionDenied("invalid token with no claims", "")
+	}
+	now := time.Now()
+	switch {
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), false):
+		return nil, serviceerror.NewPermissionDenied("token is expired", "")
+	case !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false):
+		return nil, serviceerror.NewPermissionDenied("token is not valid yet", "")
+	case !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false):
+		return nil, serviceerror.NewPermissionDenied("token used before issued", "")
+	}
+	if strings.TrimSpace(audience) != "" && !claims.VerifyAudience(audience, true) {
+		return nil, serviceerror.NewPermissionDenied("audience mismatch", "")
+	}
+	return claims, nil
+}
+
+// tokenKey returns the key of keyProvider to verify token with, by its kid and alg
+func tokenKey(keyProvider authorization.TokenKeyProvider, t *jwt.Token) (any, error) {
+	if raw, ok := keyProvider.(authorization.RawTokenKeyProvider); ok {
+		return raw.GetKey(context.Background(), t)
+	}
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		return nil, fmt.Errorf(`malformed token - no "kid" header`)
+	}
+	alg := t.Method.Alg()
+	switch t.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		return keyProvider.RsaKey(alg, kid)
+	case *jwt.SigningMethodECDSA:
+		return keyProvider.EcdsaKey(alg, kid)
+	case *jwt.SigningMethodHMAC:
+		return keyProvider.HmacKey(alg, kid)
+	}
+	return nil, serviceerror.NewPermissionDenied(fmt.Sprintf("unexpected signing method %s", alg), "")
+}
@@ -0,0 +1,202 @@
+package authorizer
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+)
+
+// testKeyProvider serves RSA keys by kid, like a JWKS endpoint
+type testKeyProvider struct {
+	rsaKeys map[string]*rsa.PublicKey
+}
+
+func (p *testKeyProvider) EcdsaKey(alg string, kid string) (*ecdsa.PublicKey, error) {
+	return nil, errors.New("no ecdsa keys")
+}
+
+func (p *testKeyProvider) HmacKey(alg string, kid string) ([]byte, error) {
+	return nil, errors.New("hmac keys are not supported")
+}
+
+func (p *testKeyProvider) RsaKey(alg string, kid string) (*rsa.PublicKey, error) {
+	if key, ok := p.rsaKeys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown kid " + kid)
+}
+
+func (p *testKeyProvider) SupportedMethods() []string {
+	return []string{"RS256", "ES256"}
+}
+
+func (p *testKeyProvider) Close() {}
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return "Bearer " + signed
+}
+
+var testJWTClaimMapping = JWTClaimMapping{
+	Claims: []string{"groups", "roles", "realm_access.roles"},
+	Rules: []JWTClaimRule{
+		{Value: "temporal-admins", System: "admin"},
+		{Claim: "groups", Value: "team-x-devs", Namespaces: map[string]string{"team-x-*": "write"}},
+		{Claim: "groups", Value: "team-x-*", Namespaces: map[string]string{"team-x-prod": "read"}},
+		{Claim: "roles", Value: "Temporal.Reader", Namespaces: map[string]string{"@all": "read"}},
+		{Claim: "realm_access.roles", Value: "oncall", Namespaces: map[string]string{"prod": "admin"}},
+	},
+}
+
+func TestJWTRoleClaimMapper_GetClaims(t *testing.T) {
+	key := newTestRSAKey(t)
+	provider := &testKeyProvider{rsaKeys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}
+	mapper, err := NewJWTRoleClaimMapper(provider, testJWTClaimMapping, log.NewTestLogger())
+	require.NoError(t, err)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	t.Run("group to namespace pattern", func(t *testing.T) {
+		token := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "alice", "exp": exp, "groups": []string{"team-x-devs", "everyone"}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", claims.Subject)
+		assert.Equal(t, authorization.RoleUndefined, claims.System)
+		assert.Equal(t, map[string]authorization.Role{"team-x-prod": authorization.RoleReader}, claims.Namespaces)
+		assert.Equal(t, authorization.RoleWriter, namespacePatternRole(claims, "team-x-staging"))
+		assert.Equal(t, authorization.RoleUndefined, namespacePatternRole(claims, "team-y-staging"))
+	})
+
+	t.Run("system role", func(t *testing.T) {
+		token := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "bob", "exp": exp, "roles": "temporal-admins"})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Equal(t, authorization.RoleAdmin, claims.System)
+	})
+
+	t.Run("rule restricted to another claim", func(t *testing.T) {
+		token := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "carol", "exp": exp, "roles": []string{"team-x-devs"}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.False(t, hasClaims(claims))
+		assert.Equal(t, "carol", claims.Subject)
+	})
+
+	t.Run("nested claim", func(t *testing.T) {
+		token := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "dave", "exp": exp, "realm_access": map[string]any{"roles": []string{"oncall"}}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Equal(t, authorization.RoleAdmin, claims.Namespaces["prod"])
+	})
+
+	t.Run("highest role wins", func(t *testing.T) {
+		token := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "erin", "exp": exp, "roles": []string{"Temporal.Reader", "temporal-admins"}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err)
+		assert.Equal(t, authorization.RoleAdmin, claims.System)
+		assert.Equal(t, authorization.RoleReader, namespacePatternRole(claims, "anything"))
+	})
+}
+
+func TestJWTRoleClaimMapper_GetClaims_Rejected(t *testing.T) {
+	key := newTestRSAKey(t)
+	provider := &testKeyProvider{rsaKeys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}
+	mapper, err := NewJWTRoleClaimMapper(provider, testJWTClaimMapping, log.NewTestLogger())
+	require.NoError(t, err)
+	valid := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "aud": "temporal", "groups": []string{"temporal-admins"}}
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		wantErr  string
+	}{
+		{"other key", signTestJWT(t, newTestRSAKey(t), "k1", valid), "", "verification error"},
+		{"unknown kid", signTestJWT(t, key, "k2", valid), "", "unknown kid k2"},
+		{"expired", signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()}), "", "expired"},
+		{"audience", signTestJWT(t, key, "k1", valid), "other", "audience mismatch"},
+		{"no subject", signTestJWT(t, key, "k1", jwt.MapClaims{"groups": []string{"temporal-admins"}}), "", `"sub"`},
+		{"alg none", "Bearer eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiJhbGljZSJ9.", "", "not allowed"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: tc.token, Audience: tc.audience})
+			require.ErrorContains(t, err, tc.wantErr)
+			assert.Nil(t, claims)
+		})
+	}
+
+	claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: signTestJWT(t, key, "k1", valid), Audience: "temporal"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.RoleAdmin, claims.System)
+}
+
+func TestJWTRoleClaimMapper_GetClaims_NotJWT(t *testing.T) {
+	mapper, err := NewJWTRoleClaimMapper(&testKeyProvider{}, testJWTClaimMapping, log.NewTestLogger())
+	require.NoError(t, err)
+	for _, token := range []string{"", "Bearer ci-bot.s3cret", "Basic dXNlcjpwYXNz", "tmprl_ci-bot_x_y"} {
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: token})
+		require.NoError(t, err, token)
+		assert.Nil(t, claims)
+	}
+}
+
+func TestJWTClaimMapping_Compile(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping JWTClaimMapping
+		wantErr string
+	}{
+		{"no rules", JWTClaimMapping{}, "rules: at least one rule is required"},
+		{"no value", JWTClaimMapping{Rules: []JWTClaimRule{{System: "admin"}}}, "rules[0].value: required"},
+		{"no grant", JWTClaimMapping{Rules: []JWTClaimRule{{Value: "g"}}}, "rules[0].system: a system role or namespaces are required"},
+		{"unknown claim", JWTClaimMapping{Rules: []JWTClaimRule{{Claim: "scp", Value: "g", System: "read"}}}, `rules[0].claim: "scp" is not one of the mapped claims groups, roles`},
+		{"unknown role", JWTClaimMapping{Rules: []JWTClaimRule{{Value: "g", System: "root"}}}, `rules[0].system: unknown role "root"`},
+		{"bad pattern", JWTClaimMapping{Rules: []JWTClaimRule{{Value: "g", Namespaces: map[string]string{"/(/": "read"}}}}, "rules[0].namespaces./(/:"},
+		{"bare wildcard", JWTClaimMapping{Rules: []JWTClaimRule{{Value: "g", Namespaces: map[string]string{"*": "read"}}}}, `rules[0].namespaces.*: ambiguous, use "@all"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.mapping.compile()
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	compiled, err := testJWTClaimMapping.compile()
+	require.NoError(t, err)
+	assert.Equal(t, testJWTClaimMapping.Claims, compiled.claims)
+	assert.Len(t, compiled.rules, len(testJWTClaimMapping.Rules))
+}
+
+func TestJWTClaimValues(t *testing.T) {
+	claims := jwt.MapClaims{
+		"groups":       []any{"a", 1, "b"},
+		"scope":        "read",
+		"realm_access": map[string]any{"roles": []any{"oncall"}},
+	}
+	assert.Equal(t, []string{"a", "b"}, jwtClaimValues(claims, "groups"))
+	assert.Equal(t, []string{"read"}, jwtClaimValues(claims, "scope"))
+	assert.Equal(t, []string{"oncall"}, jwtClaimValues(claims, "realm_access.roles"))
+	assert.Nil(t, jwtClaimValues(claims, "realm_access.groups"))
+	assert.Nil(t, jwtClaimValues(claims, "scope.roles"))
+	assert.Nil(t, jwtClaimValues(claims, "missing"))
+}
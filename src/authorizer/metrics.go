@@ -0,0 +1,169 @@
+package authorizer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/metrics"
+)
+
+const (
+	outcomeMatched = "matched"
+	outcomeSkipped = "skipped"
+	outcomeError   = "error"
+	outcomeDenied  = "denied"
+	outcomeAllowed = "allowed"
+
+	metricsTagClaimMapper = "claim_mapper"
+	metricsTagOutcome     = "outcome"
+	metricsTagKeyID       = "key_id"
+	metricsTagResult      = "result"
+	metricsTagReason      = "reason"
+
+	// metricsKeyIDNone is the key_id of calls without a subject
+	metricsKeyIDNone = "_none"
+	// metricsReasonNone is the reason of claim mapper calls which did not reject the credentials
+	metricsReasonNone = "_none"
+	// metricsKeyIDOther is the key_id of subjects seen after maxMetricsKeyIDs distinct ones
+	metricsKeyIDOther = "_other"
+	// maxMetricsKeyIDs bounds the key_id cardinality, e.g. of plaintext keys added over time
+	maxMetricsKeyIDs = 500
+)
+
+var (
+	claimMapperRequests = metrics.NewCounterDef(
+		"auth_claim_mapper_requests",
+		metrics.WithDescription("Claim mapper calls by claim_mapper, outcome (matched, skipped, error, denied), reason "+
+			"(checksum, malformed, invalid_secret, revoked, expired, not_yet_valid, secondary_credential, other) and key_id"),
+	)
+	claimMapperLatency = metrics.NewTimerDef(
+		"auth_claim_mapper_latency",
+		metrics.WithDescription("Claim mapper call latency by claim_mapper and outcome"),
+	)
+	authorizationRequests = metrics.NewCounterDef(
+		"auth_authorization_requests",
+		metrics.WithDescription("Authorization decisions by outcome (allowed, denied, error) and key_id"),
+	)
+	authorizationLatency = metrics.NewTimerDef(
+		"auth_authorization_latency",
+		metrics.WithDescription("Authorization latency by outcome"),
+	)
+	jwtCacheRequests = metrics.NewCounterDef(
+		"auth_jwt_cache_requests",
+		metrics.WithDescription("JWT claims cache lookups by claim_mapper and result (hit, negative_hit, miss)"),
+	)
+)
+
+// AuthMetrics emits claim mapping and authorization metrics through a Temporal metrics handler.
+// A nil AuthMetrics emits nothing.
+type AuthMetrics struct {
+	handler metrics.Handler
+
+	mu     sync.Mutex
+	keyIDs map[string]struct{}
+}
+
+// NewAuthMetrics emits to handler, usually the handler configured by global.metrics
+func NewAuthMetrics(handler metrics.Handler) *AuthMetrics {
+	return &AuthMetrics{handler: handler, keyIDs: make(map[string]struct{})}
+}
+
+// claimMapperCall records a single claim mapper call started at start, claims are the matched claims or nil
+// and err the error the call failed with or nil
+func (m *AuthMetrics) claimMapperCall(name, outcome string, claims *authorization.Claims, err error, start time.Time) {
+	if m == nil {
+		return
+	}
+	reason := metricsReasonNone
+	if err != nil {
+		reason = rejectionReason(err)
+	}
+	tags := []metrics.Tag{metrics.StringTag(metricsTagClaimMapper, name), metrics.StringTag(metricsTagOutcome, outcome)}
+	claimMapperRequests.With(m.handler).Record(1, append(tags,
+		metrics.StringTag(metricsTagReason, reason), metrics.StringTag(metricsTagKeyID, m.keyID(claimsKeyID(claims, name))))...)
+	claimMapperLatency.With(m.handler).Record(time.Since(start), tags...)
+}
+
+// authorization records an authorization decision started at start, latencies are not labeled by key ID
+func (m *AuthMetrics) authorization(claims *authorization.Claims, outcome string, start time.Time) {
+	if m == nil {
+		return
+	}
+	var claimMapper string
+	if claims != nil {
+		if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil && len(ext.ClaimMappers) > 0 {
+			claimMapper = ext.ClaimMappers[0]
+		}
+	}
+	authorizationRequests.With(m.handler).Record(1,
+		metrics.StringTag(metricsTagOutcome, outcome), metrics.StringTag(metricsTagKeyID, m.keyID(claimsKeyID(claims, claimMapper))))
+	authorizationLatency.With(m.handler).Record(time.Since(start), metrics.StringTag(metricsTagOutcome, outcome))
+}
+
+// jwtCacheLookup records a lookup in the JWT claims cache of a claim mapper
+func (m *AuthMetrics) jwtCacheLookup(claimMapper, result string) {
+	if m == nil {
+		return
+	}
+	jwtCacheRequests.With(m.handler).Record(1, metrics.StringTag(metricsTagClaimMapper, claimMapper), metrics.StringTag(metricsTagResult, result))
+}
+
+// claimsKeyID is the API key ID of claims, or the claim mapper name for other credentials: JWT subjects are
+// unbounded and often personal data (e-mail addresses), they are never exported as a label
+func claimsKeyID(claims *authorization.Claims, claimMapper string) string {
+	if claims == nil || claims.Subject == "" {
+		return ""
+	}
+	if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil && ext.KeyID != "" {
+		return ext.KeyID
+	}
+	return claimMapper
+}
+
+// keyID returns id as key_id value until maxMetricsKeyIDs distinct ones were seen
+func (m *AuthMetrics) keyID(id string) string {
+	if id == "" {
+		return metricsKeyIDNone
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keyIDs[id]; ok {
+		return id
+	}
+	if len(m.keyIDs) >= maxMetricsKeyIDs {
+		return metricsKeyIDOther
+	}
+	m.keyIDs[id] = struct{}{}
+	return id
+}
+
+type metricsAuthorizer struct {
+	next    authorization.Authorizer
+	metrics *AuthMetrics
+}
+
+// NewMetricsAuthorizer records the outcome and latency of next for every call but health checks
+func NewMetricsAuthorizer(next authorization.Authorizer, authMetrics *AuthMetrics) authorization.Authorizer {
+	return &metricsAuthorizer{next: next, metrics: authMetrics}
+}
+
+// Authorize asks the next authorizer and records its decision
+func (a *metricsAuthorizer) Authorize(ctx context.Context, claims *authorization.Claims, target *authorization.CallTarget) (authorization.Result, error) {
+	start := time.Now()
+	result, err := a.next.Authorize(ctx, claims, target)
+	if authorization.IsHealthCheckAPI(target.APIName) {
+		return result, err
+	}
+
+	outcome := outcomeDenied
+	switch {
+	case err != nil:
+		outcome = outcomeError
+	case result.Decision == authorization.DecisionAllow:
+		outcome = outcomeAllowed
+	}
+	a.metrics.authorization(claims, outcome, start)
+	return result, err
+}
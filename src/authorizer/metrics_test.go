@@ -0,0 +1,194 @@
+package authorizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/metrics/metricstest"
+)
+
+// recordedTags lists the tags of every recording of the metric, counters must have been recorded with 1
+func recordedTags(t *testing.T, capture *metricstest.Capture, name string) []map[string]string {
+	t.Helper()
+	var tags []map[string]string
+	for _, r := range capture.Snapshot()[name] {
+		if v, ok := r.Value.(int64); ok {
+			require.Equal(t, int64(1), v)
+		}
+		tags = append(tags, r.Tags)
+	}
+	return tags
+}
+
+func TestMultiClaimMapper_Metrics(t *testing.T) {
+	handler := metricstest.NewCaptureHandler()
+	capture := handler.StartCapture()
+	defer handler.StopCapture(capture)
+
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.SetMetrics(NewAuthMetrics(handler))
+	m.Add("broken", fakeMapper{err: assert.AnError})
+	m.Add("empty", fakeMapper{claims: &authorization.Claims{}})
+	m.Add("apiKey", fakeMapper{claims: &authorization.Claims{Subject: "ci-bot", System: authorization.RoleReader, Extensions: &ClaimsExtensions{KeyID: "ci-bot"}}})
+
+	_, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []map[string]string{
+		{"claim_mapper": "broken", "outcome": "error", "reason": "other", "key_id": "_none"},
+		{"claim_mapper": "empty", "outcome": "skipped", "reason": "_none", "key_id": "_none"},
+		{"claim_mapper": "apiKey", "outcome": "matched", "reason": "_none", "key_id": "ci-bot"},
+	}, recordedTags(t, capture, "auth_claim_mapper_requests"))
+	assert.Equal(t, []map[string]string{
+		{"claim_mapper": "broken", "outcome": "error"},
+		{"claim_mapper": "empty", "outcome": "skipped"},
+		{"claim_mapper": "apiKey", "outcome": "matched"},
+	}, recordedTags(t, capture, "auth_claim_mapper_latency"))
+}
+
+func TestMultiClaimMapper_MetricsJWTSubject(t *testing.T) {
+	handler := metricstest.NewCaptureHandler()
+	capture := handler.StartCapture()
+	defer handler.StopCapture(capture)
+
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.SetMetrics(NewAuthMetrics(handler))
+	m.Add("defaultJWTClaimMapper", fakeMapper{claims: &authorization.Claims{Subject: "alice@example.com", System: authorization.RoleReader}})
+
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{
+		{"claim_mapper": "defaultJWTClaimMapper", "outcome": "matched", "reason": "_none", "key_id": "defaultJWTClaimMapper"},
+	}, recordedTags(t, capture, "auth_claim_mapper_requests"), "JWT subjects are not exported")
+
+	_, err = NewMetricsAuthorizer(authorization.NewDefaultAuthorizer(), m.metrics).Authorize(context.Background(), claims,
+		&authorization.CallTarget{APIName: apiStart, Namespace: "orders"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{
+		{"outcome": "denied", "key_id": "defaultJWTClaimMapper"},
+	}, recordedTags(t, capture, "auth_authorization_requests"))
+}
+
+func TestMultiClaimMapper_MetricsTerminalError(t *testing.T) {
+	handler := metricstest.NewCaptureHandler()
+	capture := handler.StartCapture()
+	defer handler.StopCapture(capture)
+
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.SetMetrics(NewAuthMetrics(handler))
+	m.Add("apiKey", fakeMapper{err: newTerminalError(serviceerror.NewPermissionDenied("api key revoked", ""))})
+	m.Add("jwt", fakeMapper{claims: &authorization.Claims{Subject: "alice"}})
+
+	_, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.Error(t, err)
+	assert.Equal(t, []map[string]string{
+		{"claim_mapper": "apiKey", "outcome": "denied", "reason": "other", "key_id": "_none"},
+	}, recordedTags(t, capture, "auth_claim_mapper_requests"))
+}
+
+func TestMultiClaimMapper_MetricsRejectionReason(t *testing.T) {
+	token, secret, err := GenerateAPIKey("ci-bot")
+	require.NoError(t, err)
+	hash, err := HashAPIKeySecret(secret, hashSchemeSHA256)
+	require.NoError(t, err)
+	apiKeyMapper, err := NewAPIKeyClaimMapper("ci-bot"+hash+":write:orders;old-bot"+hash+":write:orders", log.NewTestLogger())
+	require.NoError(t, err)
+	set := apiKeyMapper.(*apiKeyClaimMapper).set.Load()
+	set.revoked = map[string]revocation{"old-bot": {}}
+	set.keys["ci-bot"].expiresAt = time.Now().Add(-time.Hour)
+
+	// a typo in the secret
+	typo := strings.Replace(token, secret, "X"+secret[1:], 1)
+	if typo == token {
+		typo = strings.Replace(token, secret, "Y"+secret[1:], 1)
+	}
+	tests := []struct {
+		name   string
+		token  string
+		reason string
+	}{
+		{"checksum", typo, "checksum"},
+		{"malformed", "tmprl_ci-bot_short_00000000", "malformed"},
+		{"revoked", "old-bot." + secret, "revoked"},
+		{"expired", token, "expired"},
+		{"revoked with a wrong secret", "old-bot.wrong", "revoked"},
+		{"guess", "ci-bot.wrong", "invalid_secret"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := metricstest.NewCaptureHandler()
+			capture := handler.StartCapture()
+			defer handler.StopCapture(capture)
+
+			m := NewMultiClaimMapper(log.NewTestLogger())
+			m.SetMetrics(NewAuthMetrics(handler))
+			m.Add("apiKeyClaimMapper", apiKeyMapper)
+			_, _ = m.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer " + tc.token})
+			tags := recordedTags(t, capture, "auth_claim_mapper_requests")
+			require.Len(t, tags, 1)
+			assert.Equal(t, tc.reason, tags[0]["reason"])
+		})
+	}
+}
+
+func TestMetricsAuthorizer(t *testing.T) {
+	handler := metricstest.NewCaptureHandler()
+	capture := handler.StartCapture()
+	defer handler.StopCapture(capture)
+
+	authMetrics := NewAuthMetrics(handler)
+	authz := NewMetricsAuthorizer(authorization.NewDefaultAuthorizer(), authMetrics)
+	claims := &authorization.Claims{Subject: "ci-bot", Namespaces: map[string]authorization.Role{"orders": authorization.RoleWriter},
+		Extensions: &ClaimsExtensions{ClaimMappers: []string{"apiKeyClaimMapper"}, KeyID: "ci-bot"}}
+
+	ctx := context.Background()
+	_, err := authz.Authorize(ctx, claims, &authorization.CallTarget{APIName: apiStart, Namespace: "orders"})
+	require.NoError(t, err)
+	_, err = authz.Authorize(ctx, claims, &authorization.CallTarget{APIName: apiStart, Namespace: "billing"})
+	require.NoError(t, err)
+	_, err = authz.Authorize(ctx, nil, &authorization.CallTarget{APIName: apiStart, Namespace: "orders"})
+	require.NoError(t, err)
+	_, err = authz.Authorize(ctx, nil, &authorization.CallTarget{APIName: apiHealth})
+	require.NoError(t, err)
+
+	failing := NewMetricsAuthorizer(authorizerFunc(func(context.Context, *authorization.Claims, *authorization.CallTarget) (authorization.Result, error) {
+		return authorization.Result{}, assert.AnError
+	}), authMetrics)
+	_, err = failing.Authorize(ctx, claims, &authorization.CallTarget{APIName: apiStart, Namespace: "orders"})
+	require.Error(t, err)
+
+	assert.Equal(t, []map[string]string{
+		{"outcome": "allowed", "key_id": "ci-bot"},
+		{"outcome": "denied", "key_id": "ci-bot"},
+		{"outcome": "denied", "key_id": "_none"},
+		{"outcome": "error", "key_id": "ci-bot"},
+	}, recordedTags(t, capture, "auth_authorization_requests"), "health checks are not counted")
+	assert.Len(t, recordedTags(t, capture, "auth_authorization_latency"), 4)
+}
+
+func TestAuthMetrics_KeyIDCardinality(t *testing.T) {
+	m := NewAuthMetrics(metricstest.NewCaptureHandler())
+	for i := range maxMetricsKeyIDs {
+		assert.Equal(t, fmt.Sprintf("key-%d", i), m.keyID(fmt.Sprintf("key-%d", i)))
+	}
+	assert.Equal(t, metricsKeyIDOther, m.keyID("one-too-many"))
+	assert.Equal(t, "key-0", m.keyID("key-0"), "known key IDs keep their label")
+	assert.Equal(t, metricsKeyIDNone, m.keyID(""))
+}
+
+func TestAuthMetrics_Nil(t *testing.T) {
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.Add("apiKey", fakeMapper{claims: &authorization.Claims{Subject: "ci-bot"}})
+	assert.NotPanics(t, func() {
+		_, _ = m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+		_, _ = NewMetricsAuthorizer(authorization.NewDefaultAuthorizer(), nil).Authorize(context.Background(), nil, &authorization.CallTarget{APIName: apiStart})
+	})
+}
@@ -1,56 +1,240 @@
 package authorizer
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.temporal.io/server/common/authorization"
 	logpkg "go.temporal.io/server/common/log"
 	"go.temporal.io/server/common/log/tag"
 )
 
+// MergeStrategy decides how MultiClaimMapper combines the claims of several claim mappers
+type MergeStrategy string
+
+const (
+	// MergeFirstMatch returns the claims of the first claim mapper recognizing the credentials
+	MergeFirstMatch MergeStrategy = "first-match"
+	// MergeUnion asks all claim mappers and keeps the highest role per namespace
+	MergeUnion MergeStrategy = "union"
+	// MergeIntersection asks all claim mappers and keeps only the roles all successful ones agree on
+	MergeIntersection MergeStrategy = "intersection"
+)
+
+// ParseMergeStrategy parses first-match, union or intersection
+func ParseMergeStrategy(strategy string) (MergeStrategy, error) {
+	switch s := MergeStrategy(strings.ToLower(strategy)); s {
+	case MergeFirstMatch, MergeUnion, MergeIntersection:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown claim-mapper merge strategy %q - expected %s, %s or %s",
+		strategy, MergeFirstMatch, MergeUnion, MergeIntersection)
+}
+
 // MultiClaimMapper enable multiple claim mappers at the same time
 type MultiClaimMapper struct {
-	logger       logpkg.Logger
-	claimMappers map[string]authorization.ClaimMapper
+	logger   logpkg.Logger
+	strategy MergeStrategy
+	// claimMappers are asked in this order, registration order unless changed with SetOrder
+	claimMappers []namedClaimMapper
+	// deferRejections passes rejected credentials on to the authorizer instead of failing the call, see SetDeferRejections
+	deferRejections bool
+	// metrics records the outcome and latency of every claim mapper call
+	metrics *AuthMetrics
+}
+
+type namedClaimMapper struct {
+	name        string
+	claimMapper authorization.ClaimMapper
+	policy      *claimsPolicy
 }
 
 // NewMultiClaimMapper creates a new MultiClaimMapper
 func NewMultiClaimMapper(logger logpkg.Logger) *MultiClaimMapper {
-	return &MultiClaimMapper{logger: logger, claimMappers: map[string]authorization.ClaimMapper{}}
+	return &MultiClaimMapper{logger: logger, strategy: MergeFirstMatch}
+}
+
+// SetStrategy changes how the claims of several claim mappers are combined, MergeFirstMatch by default
+func (m *MultiClaimMapper) SetStrategy(strategy MergeStrategy) {
+	m.strategy = strategy
+	m.logger.Info("auth: claim-mapper merge strategy", tag.NewStringTag("strategy", string(strategy)))
 }
 
-// Add new claim mapper to the chain
+// Add new claim mapper to the end of the chain, a mapper with the same name is replaced in place
 func (m *MultiClaimMapper) Add(claimMapperName string, claimMapper authorization.ClaimMapper) {
-	m.claimMappers[claimMapperName] = claimMapper
-	m.logger.Info("auth: claim-mapper registered", tag.Name(claimMapperName))
+	if i := m.indexOf(claimMapperName); i >= 0 {
+		m.claimMappers[i].claimMapper = claimMapper
+	} else {
+		m.claimMappers = append(m.claimMappers, namedClaimMapper{name: claimMapperName, claimMapper: claimMapper})
+	}
+	m.logger.Info("auth: claim-mapper registered", tag.Name(claimMapperName), tag.NewInt("position", m.indexOf(claimMapperName)))
 }
 
-// GetClaims converts authorization info of a subject into Temporal claims (permissions) for authorization
+// Remove takes a claim mapper out of the chain, reports whether it was registered
+func (m *MultiClaimMapper) Remove(claimMapperName string) bool {
+	i := m.indexOf(claimMapperName)
+	if i < 0 {
+		return false
+	}
+	m.claimMappers = append(m.claimMappers[:i], m.claimMappers[i+1:]...)
+	m.logger.Info("auth: claim-mapper removed", tag.Name(claimMapperName))
+	return true
+}
+
+// ClaimMapper returns the registered claim mapper, nil if unknown
+func (m *MultiClaimMapper) ClaimMapper(claimMapperName string) authorization.ClaimMapper {
+	if i := m.indexOf(claimMapperName); i >= 0 {
+		return m.claimMappers[i].claimMapper
+	}
+	return nil
+}
+
+// SetDeferRejections passes credentials the claim mappers reject on to the authorizer in ClaimsExtensions.Rejections,
+// so the audit authorizer (see NewAuditAuthorizer) records them with the API, namespace and peer of the call.
+// A terminal rejection (e.g. a revoked key) then yields claims without any role instead of an error, which
+// NewAuditAuthorizer denies without asking the authorizers it wraps.
+func (m *MultiClaimMapper) SetDeferRejections(deferRejections bool) {
+	m.deferRejections = deferRejections
+}
+
+// SetMetrics records the outcome and latency of every claim mapper call
+func (m *MultiClaimMapper) SetMetrics(authMetrics *AuthMetrics) {
+	m.metrics = authMetrics
+}
+
+// SetPolicy sets the post-processing policy of a registered claim mapper
+func (m *MultiClaimMapper) SetPolicy(claimMapperName string, policy ClaimMapperPolicy) error {
+	i := m.indexOf(claimMapperName)
+	if i < 0 {
+		return fmt.Errorf("claim-mapper policy: unknown claim-mapper %q", claimMapperName)
+	}
+	compiled, err := policy.compile()
+	if err != nil {
+		return fmt.Errorf("claim-mapper policy %s: %w", claimMapperName, err)
+	}
+	m.claimMappers[i].policy = compiled
+	m.logger.Info("auth: claim-mapper policy set", tag.Name(claimMapperName))
+	return nil
+}
+
+// SetOrder moves the named claim mappers to the front of the chain in the given order,
+// the others keep their registration order after them.
+func (m *MultiClaimMapper) SetOrder(names ...string) error {
+	ordered := make([]namedClaimMapper, 0, len(m.claimMappers))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		i := m.indexOf(name)
+		if i < 0 {
+			return fmt.Errorf("claim-mapper order: unknown claim-mapper %q", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("claim-mapper order: duplicate claim-mapper %q", name)
+		}
+		seen[name] = true
+		ordered = append(ordered, m.claimMappers[i])
+	}
+	for _, cm := range m.claimMappers {
+		if !seen[cm.name] {
+			ordered = append(ordered, cm)
+		}
+	}
+	m.claimMappers = ordered
+	m.logger.Info("auth: claim-mapper order", tag.NewStringsTag("names", m.Names()))
+	return nil
+}
+
+// Names of the registered claim mappers in the order they are asked
+func (m *MultiClaimMapper) Names() []string {
+	names := make([]string, 0, len(m.claimMappers))
+	for _, cm := range m.claimMappers {
+		names = append(names, cm.name)
+	}
+	return names
+}
+
+func (m *MultiClaimMapper) indexOf(name string) int {
+	for i, cm := range m.claimMappers {
+		if cm.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetClaims converts authorization info of a subject into Temporal claims (permissions) for authorization.
+// Claim mappers are asked in order and their claims combined according to the merge strategy,
+// the names of the contributing mappers are recorded in ClaimsExtensions.
 func (m *MultiClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
-	for name, cm := range m.claimMappers {
-		claims, err := cm.GetClaims(authInfo)
+	var merged *authorization.Claims
+	var contributors []string
+	var rejections []ClaimMapperRejection
+	for _, ncm := range m.claimMappers {
+		name := ncm.name
+		start := time.Now()
+		claims, err := ncm.claimMapper.GetClaims(authInfo)
 		if err != nil {
-			m.logger.Warn("auth: claim-mapper error", tag.Name(name), tag.Error(err))
+			if isTerminalError(err) {
+				m.logger.Warn("auth: claim-mapper rejected the credentials", tag.Name(name), tag.Error(err))
+				m.metrics.claimMapperCall(name, outcomeDenied, nil, err, start)
+				if m.deferRejections {
+					rejection := ClaimMapperRejection{ClaimMapper: name, Reason: rejectionReason(err), Message: err.Error(), Terminal: true}
+					return &authorization.Claims{Extensions: &ClaimsExtensions{Rejections: append(rejections, rejection)}}, nil
+				}
+				return nil, err
+			}
+			rejections = append(rejections, ClaimMapperRejection{ClaimMapper: name, Reason: rejectionReason(err), Message: err.Error()})
+			if errors.Is(err, errMalformedJWT) {
+				// a client error rather than a claim mapper failure
+				m.logger.Info("auth: claim-mapper rejected a malformed jwt", tag.Name(name), tag.Error(err))
+			} else {
+				m.logger.Warn("auth: claim-mapper error", tag.Name(name), tag.Error(err))
+			}
+			m.metrics.claimMapperCall(name, outcomeError, nil, err, start)
 			continue
 		}
 		if !hasClaims(claims) {
 			m.logger.Debug("auth: claim-mapper skipped: no claims recognized", tag.Name(name))
+			m.metrics.claimMapperCall(name, outcomeSkipped, nil, nil, start)
 			continue
 		}
+		m.metrics.claimMapperCall(name, outcomeMatched, claims, nil, start)
+		claims = cloneClaims(claims)
 		m.logger.Info("auth: claim-mapper selected and permissions identified",
 			tag.Name(name), tag.NewStringTag("claims", fmt.Sprintf("sys:%v,ns:%v", claims.System, claims.Namespaces)))
 
-		if name == "defaultJWTClaimMapper" {
-			m.logger.Warn("auth: temp WORKAROUND for DefaultJWTClaimMapper - set TestWorkflows:admin role", tag.Name(name))
-			claims.Namespaces["TestWorkflows"] = authorization.RoleAdmin
-		}
-		if name == "extraDataJWTClamMapper" {
-			m.logger.Warn("auth: temp WORKAROUND for ExtraDataJWTClamMapper - set System:admin role", tag.Name(name))
-			claims.System = authorization.RoleAdmin
+		if ncm.policy != nil {
+			ncm.policy.apply(claims)
+			m.logger.Debug("auth: claim-mapper policy applied",
+				tag.Name(name), tag.NewStringTag("claims", fmt.Sprintf("sys:%v,ns:%v", claims.System, claims.Namespaces)))
 		}
 
-		return claims, nil
+		contributors = append(contributors, name)
+		switch {
+		case merged == nil:
+			merged = claims
+		case m.strategy == MergeUnion:
+			merged = unionClaims(merged, claims)
+		case m.strategy == MergeIntersection:
+			merged = intersectClaims(merged, claims)
+		}
+		if m.strategy == MergeFirstMatch {
+			break
+		}
+	}
+	if merged == nil {
+		m.logger.Warn("auth: no claim-mapper recognized the credentials")
+		if m.deferRejections && len(rejections) > 0 {
+			return &authorization.Claims{Extensions: &ClaimsExtensions{Rejections: rejections}}, nil
+		}
+		return &authorization.Claims{}, nil
+	}
+	if !hasClaims(merged) {
+		m.logger.Warn("auth: claim-mappers do not agree on any permission",
+			tag.NewStringTag("strategy", string(m.strategy)), tag.NewStringsTag("claim-mappers", contributors))
+		return &authorization.Claims{}, nil
 	}
-	m.logger.Warn("auth: no claim-mapper recognized the credentials")
-	return &authorization.Claims{}, nil
+	extensionsOf(merged).ClaimMappers = contributors
+	return merged, nil
 }
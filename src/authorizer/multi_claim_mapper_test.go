@@ -2,6 +2,7 @@ package authorizer
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,3 +45,187 @@ func TestMultiClaimMapper_ErrorPropagation(t *testing.T) {
 	assert.NotNil(t, claims)
 	assert.NoError(t, err)
 }
+
+func TestMultiClaimMapper_TerminalErrorStops(t *testing.T) {
+	logger := log.NewTestLogger()
+	m := NewMultiClaimMapper(logger)
+	m.Add("fakeMapper1", fakeMapper{err: newTerminalError(errors.New("api key revoked"))})
+	m.Add("fakeMapper2", fakeMapper{err: errors.New("not a jwt")})
+	m.Add("fakeMapper3", fakeMapper{claims: &authorization.Claims{}})
+
+	for range 20 {
+		claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+		require.EqualError(t, err, "api key revoked")
+		assert.Nil(t, claims)
+	}
+}
+
+func TestMultiClaimMapper_RegistrationOrderIsStable(t *testing.T) {
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	for _, name := range []string{"m1", "m2", "m3", "m4", "m5", "m6", "m7", "m8"} {
+		m.Add(name, fakeMapper{claims: &authorization.Claims{Subject: name, System: authorization.RoleReader}})
+	}
+
+	for range 500 {
+		claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+		require.NoError(t, err)
+		require.Equal(t, "m1", claims.Subject)
+	}
+}
+
+func TestMultiClaimMapper_SetOrder(t *testing.T) {
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.Add("jwt", fakeMapper{claims: &authorization.Claims{Subject: "jwt", System: authorization.RoleReader}})
+	m.Add("apiKey", fakeMapper{claims: &authorization.Claims{Subject: "apiKey", System: authorization.RoleReader}})
+	m.Add("extra", fakeMapper{claims: &authorization.Claims{Subject: "extra", System: authorization.RoleReader}})
+	m.Add("other", fakeMapper{claims: &authorization.Claims{Subject: "other", System: authorization.RoleReader}})
+	require.Equal(t, []string{"jwt", "apiKey", "extra", "other"}, m.Names())
+
+	require.NoError(t, m.SetOrder("apiKey", "extra"))
+	assert.Equal(t, []string{"apiKey", "extra", "jwt", "other"}, m.Names())
+	for range 500 {
+		claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+		require.NoError(t, err)
+		require.Equal(t, "apiKey", claims.Subject)
+	}
+
+	require.Error(t, m.SetOrder("missing"))
+	require.Error(t, m.SetOrder("jwt", "jwt"))
+	assert.Equal(t, []string{"apiKey", "extra", "jwt", "other"}, m.Names(), "order unchanged on error")
+
+	// replacing a mapper keeps its position
+	m.Add("jwt", fakeMapper{})
+	assert.Equal(t, []string{"apiKey", "extra", "jwt", "other"}, m.Names())
+
+	assert.True(t, m.Remove("extra"))
+	assert.False(t, m.Remove("extra"))
+	assert.Equal(t, []string{"apiKey", "jwt", "other"}, m.Names())
+}
+
+func TestMultiClaimMapper_SetOrderDecidesTerminalError(t *testing.T) {
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.Add("jwt", fakeMapper{claims: &authorization.Claims{Subject: "jwt", System: authorization.RoleAdmin}})
+	m.Add("apiKey", fakeMapper{err: newTerminalError(errors.New("api key revoked"))})
+
+	// registered after a mapper which accepts the request, the terminal error is never reached
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, "jwt", claims.Subject)
+
+	// moved to the front, it stops the chain before the other mapper is asked
+	require.NoError(t, m.SetOrder("apiKey"))
+	for range 500 {
+		claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+		require.EqualError(t, err, "api key revoked")
+		require.Nil(t, claims)
+	}
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	for _, s := range []string{"first-match", "union", "INTERSECTION"} {
+		_, err := ParseMergeStrategy(s)
+		require.NoError(t, err, s)
+	}
+	_, err := ParseMergeStrategy("any")
+	require.Error(t, err)
+}
+
+func TestMultiClaimMapper_MergeStrategies(t *testing.T) {
+	mtls := &authorization.Claims{Subject: "worker-cert", Namespaces: map[string]authorization.Role{
+		"orders":  authorization.RoleWriter,
+		"billing": authorization.RoleReader,
+	}}
+	jwt := &authorization.Claims{Subject: "user", Namespaces: map[string]authorization.Role{
+		"orders":  authorization.RoleReader,
+		"billing": authorization.RoleAdmin,
+		"audit":   authorization.RoleReader,
+	}}
+	sysReader := &authorization.Claims{Subject: "sys", System: authorization.RoleReader}
+
+	tests := []struct {
+		name         string
+		strategy     MergeStrategy
+		mappers      []*authorization.Claims
+		subject      string
+		system       authorization.Role
+		namespaces   map[string]authorization.Role
+		claimMappers []string
+	}{
+		{"first-match", MergeFirstMatch, []*authorization.Claims{mtls, jwt}, "worker-cert", authorization.RoleUndefined,
+			mtls.Namespaces, []string{"m0"}},
+		{"union", MergeUnion, []*authorization.Claims{mtls, jwt}, "worker-cert", authorization.RoleUndefined,
+			map[string]authorization.Role{"orders": authorization.RoleWriter, "billing": authorization.RoleAdmin, "audit": authorization.RoleReader},
+			[]string{"m0", "m1"}},
+		{"intersection", MergeIntersection, []*authorization.Claims{mtls, jwt}, "worker-cert", authorization.RoleUndefined,
+			map[string]authorization.Role{"orders": authorization.RoleReader, "billing": authorization.RoleReader},
+			[]string{"m0", "m1"}},
+		{"intersection with system role", MergeIntersection, []*authorization.Claims{sysReader, mtls}, "sys", authorization.RoleUndefined,
+			map[string]authorization.Role{"orders": authorization.RoleReader, "billing": authorization.RoleReader},
+			[]string{"m0", "m1"}},
+		{"union with system role", MergeUnion, []*authorization.Claims{mtls, sysReader}, "worker-cert", authorization.RoleReader,
+			mtls.Namespaces, []string{"m0", "m1"}},
+		{"intersection single mapper", MergeIntersection, []*authorization.Claims{nil, jwt}, "user", authorization.RoleUndefined,
+			jwt.Namespaces, []string{"m1"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewMultiClaimMapper(log.NewTestLogger())
+			m.SetStrategy(tc.strategy)
+			for i, c := range tc.mappers {
+				m.Add(fmt.Sprintf("m%d", i), fakeMapper{claims: c})
+			}
+			m.Add("failing", fakeMapper{err: errors.New("boom")})
+
+			claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+			require.NoError(t, err)
+			assert.Equal(t, tc.subject, claims.Subject)
+			assert.Equal(t, tc.system, claims.System)
+			assert.Equal(t, tc.namespaces, claims.Namespaces)
+			require.IsType(t, &ClaimsExtensions{}, claims.Extensions)
+			assert.Equal(t, tc.claimMappers, claims.Extensions.(*ClaimsExtensions).ClaimMappers)
+		})
+	}
+
+	// the mappers' own claims are never modified
+	assert.Len(t, mtls.Namespaces, 2)
+	assert.Nil(t, mtls.Extensions)
+}
+
+func TestMultiClaimMapper_IntersectionWithoutAgreement(t *testing.T) {
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.SetStrategy(MergeIntersection)
+	m.Add("m0", fakeMapper{claims: &authorization.Claims{Namespaces: map[string]authorization.Role{"a": authorization.RoleAdmin}}})
+	m.Add("m1", fakeMapper{claims: &authorization.Claims{Namespaces: map[string]authorization.Role{"b": authorization.RoleAdmin}}})
+
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "x"})
+	require.NoError(t, err)
+	assert.False(t, hasClaims(claims))
+}
+
+func TestMergeClaims_CombinedRoles(t *testing.T) {
+	worker := authorization.RoleWorker | authorization.RoleReader
+	a := &authorization.Claims{System: worker, Namespaces: map[string]authorization.Role{
+		"orders": worker, "billing": authorization.RoleAdmin, "jobs": worker,
+	}}
+	b := &authorization.Claims{System: authorization.RoleWriter, Namespaces: map[string]authorization.Role{
+		"orders": authorization.RoleWriter, "billing": authorization.RoleWorker | authorization.RoleWriter, "jobs": authorization.RoleWorker,
+	}}
+
+	// the worker bit is kept next to a higher role, read is covered by write
+	union := unionClaims(a, b)
+	assert.Equal(t, authorization.RoleWorker|authorization.RoleWriter, union.System)
+	assert.Equal(t, map[string]authorization.Role{
+		"orders":  authorization.RoleWorker | authorization.RoleWriter,
+		"billing": authorization.RoleWorker | authorization.RoleAdmin,
+		"jobs":    worker,
+	}, union.Namespaces)
+
+	// admin covers write and write covers read, worker only intersects with worker
+	intersection := intersectClaims(a, b)
+	assert.Equal(t, authorization.RoleReader, intersection.System)
+	assert.Equal(t, map[string]authorization.Role{
+		"orders":  authorization.RoleReader,
+		"billing": authorization.RoleWorker | authorization.RoleWriter,
+		"jobs":    worker,
+	}, intersection.Namespaces)
+}
@@ -0,0 +1,98 @@
+package authorizer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.temporal.io/server/common/authorization"
+)
+
+const (
+	// namespaceAll grants a role on every namespace, unlike a system role it does not cover cluster-level APIs
+	namespaceAll = "@all"
+	// namespaceSystem grants a system (cluster-level) role
+	namespaceSystem = "@system"
+	// namespaceSystemDeprecated is the former system grant of TEMPORAL_API_KEYS, kept as an alias of namespaceSystem.
+	// The registry file, role rules and policies reject it, namespaceAll or namespaceSystem must be explicit there.
+	namespaceSystemDeprecated = "*"
+)
+
+// errAmbiguousNamespace rejects namespaceSystemDeprecated outside of TEMPORAL_API_KEYS, where a glob would read it as
+// every namespace; moving a grant from TEMPORAL_API_KEYS must not change its meaning
+var errAmbiguousNamespace = fmt.Errorf(`ambiguous, use "%s" for every namespace or "%s" for a system role`, namespaceAll, namespaceSystem)
+
+// NamespacePattern grants Role on every namespace matching Pattern
+type NamespacePattern struct {
+	// Pattern as configured: a glob ("team-a-*"), an anchored regular expression ("/team-a-(prod|staging)/") or "@all"
+	Pattern string
+	Role    authorization.Role
+
+	glob string
+	re   *regexp.Regexp
+}
+
+// parseNamespacePattern returns nil for an exact namespace name
+func parseNamespacePattern(namespace string, role authorization.Role) (*NamespacePattern, error) {
+	p := &NamespacePattern{Pattern: namespace, Role: role}
+	switch {
+	case namespace == namespaceAll:
+		p.glob = "*"
+	case len(namespace) > 2 && strings.HasPrefix(namespace, "/") && strings.HasSuffix(namespace, "/"):
+		re, err := regexp.Compile("^(?:" + namespace[1:len(namespace)-1] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace regexp %s: %w", namespace, err)
+		}
+		p.re = re
+	case strings.ContainsAny(namespace, "*?"):
+		p.glob = namespace
+	default:
+		return nil, nil
+	}
+	return p, nil
+}
+
+// Match reports whether the namespace is covered by the pattern
+func (p *NamespacePattern) Match(namespace string) bool {
+	if p.re != nil {
+		return p.re.MatchString(namespace)
+	}
+	return globMatch(p.glob, namespace)
+}
+
+// namespacePatternRole is the highest role of the patterns matching namespace
+func namespacePatternRole(claims *authorization.Claims, namespace string) authorization.Role {
+	ext, ok := claims.Extensions.(*ClaimsExtensions)
+	if !ok || ext == nil || namespace == "" {
+		return authorization.RoleUndefined
+	}
+	var role authorization.Role
+	for i := range ext.NamespacePatterns {
+		if ext.NamespacePatterns[i].Match(namespace) {
+			role = max(role, ext.NamespacePatterns[i].Role)
+		}
+	}
+	return role
+}
+
+type namespacePatternAuthorizer struct {
+	next authorization.Authorizer
+}
+
+// NewNamespacePatternAuthorizer creates an authorizer which resolves the namespace patterns of the claims
+// for the target namespace and passes the expanded claims to next.
+func NewNamespacePatternAuthorizer(next authorization.Authorizer) authorization.Authorizer {
+	return &namespacePatternAuthorizer{next: next}
+}
+
+// Authorize adds the role granted by matching namespace patterns to the claims
+func (a *namespacePatternAuthorizer) Authorize(ctx context.Context, claims *authorization.Claims, target *authorization.CallTarget) (authorization.Result, error) {
+	if claims != nil {
+		if role := namespacePatternRole(claims, target.Namespace); role > claims.Namespaces[target.Namespace] {
+			claims = cloneClaims(claims)
+			claims.Namespaces[target.Namespace] = role
+		}
+	}
+	return a.next.Authorize(ctx, claims, target)
+}
@@ -0,0 +1,125 @@
+package authorizer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+)
+
+func TestParseNamespacePattern(t *testing.T) {
+	tests := []struct {
+		namespace string
+		matches   []string
+		misses    []string
+	}{
+		{"team-a-*", []string{"team-a-prod", "team-a-"}, []string{"team-b-prod", "xteam-a-prod"}},
+		{"ns?", []string{"ns1"}, []string{"ns", "ns12"}},
+		{"/team-a-(prod|staging)/", []string{"team-a-prod", "team-a-staging"}, []string{"team-a-dev", "team-a-prod2", "xteam-a-prod"}},
+		{"@all", []string{"anything", "team-a-prod"}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.namespace, func(t *testing.T) {
+			p, err := parseNamespacePattern(tc.namespace, authorization.RoleReader)
+			require.NoError(t, err)
+			require.NotNil(t, p)
+			assert.Equal(t, tc.namespace, p.Pattern)
+			for _, ns := range tc.matches {
+				assert.True(t, p.Match(ns), ns)
+			}
+			for _, ns := range tc.misses {
+				assert.False(t, p.Match(ns), ns)
+			}
+		})
+	}
+
+	p, err := parseNamespacePattern("exact-name", authorization.RoleReader)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	_, err = parseNamespacePattern("/(/", authorization.RoleReader)
+	require.Error(t, err)
+}
+
+func TestParseApiKeysString_NamespacePatterns(t *testing.T) {
+	keys, err := parseAPIKeysString("team-a:write:team-a-*,read:@all,admin:team-a-sandbox;re:read:/billing-(eu|us)/")
+	require.NoError(t, err)
+
+	c := keys[plaintextID("team-a")].claims
+	assert.Equal(t, authorization.RoleUndefined, c.System, "@all is not a system role")
+	assert.Equal(t, map[string]authorization.Role{"team-a-sandbox": authorization.RoleAdmin}, c.Namespaces)
+	assert.Equal(t, authorization.RoleWriter, namespacePatternRole(c, "team-a-prod"))
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(c, "other"))
+	assert.True(t, hasClaims(c))
+
+	re := keys[plaintextID("re")].claims
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(re, "billing-eu"))
+	assert.Equal(t, authorization.RoleUndefined, namespacePatternRole(re, "billing-asia"))
+
+	_, err = parseAPIKeysString("k:write:team-*;k:read:team-*")
+	require.Error(t, err)
+}
+
+func TestNamespacePatternAuthorizer(t *testing.T) {
+	mapper, err := NewAPIKeyClaimMapper("team-a:write:team-a-*,read:@all", log.NewTestLogger())
+	require.NoError(t, err)
+	m := NewMultiClaimMapper(log.NewTestLogger())
+	m.Add("apiKeyClaimMapper", mapper)
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer team-a"})
+	require.NoError(t, err)
+
+	a := NewNamespacePatternAuthorizer(authorization.NewDefaultAuthorizer())
+	tests := []struct {
+		name      string
+		namespace string
+		api       string
+		decision  authorization.Decision
+	}{
+		{"write on pattern", "team-a-prod", apiStart, authorization.DecisionAllow},
+		{"read everywhere", "team-b-prod", apiDescribe, authorization.DecisionAllow},
+		{"no write elsewhere", "team-b-prod", apiStart, authorization.DecisionDeny},
+		{"no cluster-level access", "", "/temporal.api.operatorservice.v1.OperatorService/AddSearchAttributes", authorization.DecisionDeny},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := a.Authorize(context.Background(), claims, &authorization.CallTarget{APIName: tc.api, Namespace: tc.namespace})
+			require.NoError(t, err)
+			assert.Equal(t, tc.decision, result.Decision)
+		})
+	}
+	assert.Empty(t, claims.Namespaces, "claims are not modified")
+}
+
+func TestClaimMapperPolicy_CapsNamespacePatterns(t *testing.T) {
+	keys, err := parseAPIKeysString("k:admin:@all")
+	require.NoError(t, err)
+	claims := cloneClaims(keys[plaintextID("k")].claims)
+	policy, err := (&ClaimMapperPolicy{MaxRole: "read"}).compile()
+	require.NoError(t, err)
+	policy.apply(claims)
+
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(claims, "any"))
+	assert.Equal(t, authorization.RoleAdmin, namespacePatternRole(keys[plaintextID("k")].claims, "any"), "original is not modified")
+}
+
+func TestMergeClaims_NamespacePatterns(t *testing.T) {
+	keys, err := parseAPIKeysString("a:write:team-a-*;b:read:team-*,write:other")
+	require.NoError(t, err)
+	a, b := keys[plaintextID("a")].claims, keys[plaintextID("b")].claims
+
+	union := unionClaims(a, b)
+	assert.Equal(t, authorization.RoleWriter, namespacePatternRole(union, "team-a-prod"))
+	assert.Equal(t, authorization.RoleReader, namespacePatternRole(union, "team-b-prod"))
+	assert.Equal(t, authorization.RoleWriter, union.Namespaces["other"])
+
+	intersection := intersectClaims(a, b)
+	assert.Empty(t, namespacePatterns(intersection))
+	assert.Empty(t, intersection.Namespaces)
+
+	c := &authorization.Claims{Namespaces: map[string]authorization.Role{"team-a-prod": authorization.RoleAdmin}}
+	intersection = intersectClaims(c, a)
+	assert.Equal(t, map[string]authorization.Role{"team-a-prod": authorization.RoleWriter}, intersection.Namespaces)
+}
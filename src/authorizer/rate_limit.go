@@ -0,0 +1,175 @@
+package authorizer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/errordetails/v1"
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// rateLimiterSweepInterval is how often limiters of subjects which are back to a full bucket are dropped
+const rateLimiterSweepInterval = time.Minute
+
+// RateLimit is a token bucket: RPS requests per second on average and bursts of up to Burst requests.
+// RPS 0 is unlimited, Burst defaults to RPS rounded up.
+type RateLimit struct {
+	RPS   float64 `yaml:"rps" json:"rps"`
+	Burst int     `yaml:"burst" json:"burst,omitempty"`
+}
+
+func (l *RateLimit) validate() error {
+	if l.RPS < 0 || math.IsNaN(l.RPS) || math.IsInf(l.RPS, 0) {
+		return fmt.Errorf("rps: must be a non-negative number")
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("burst: must not be negative")
+	}
+	return nil
+}
+
+func (l *RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return max(1, int(math.Ceil(l.RPS)))
+}
+
+// rateLimitOf returns the rate limit an API key claim mapper attached to the claims, if any
+func rateLimitOf(claims *authorization.Claims) *RateLimit {
+	if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil {
+		return ext.RateLimit
+	}
+	return nil
+}
+
+// rateLimitKey is the bucket of the claims: the first claim mapper and the API key ID or, for other credentials, the subject.
+// A JWT "sub" equal to an API key ID does not share the key's bucket.
+func rateLimitKey(claims *authorization.Claims) string {
+	mapper, id := "", claims.Subject
+	if ext, ok := claims.Extensions.(*ClaimsExtensions); ok && ext != nil {
+		if len(ext.ClaimMappers) > 0 {
+			mapper = ext.ClaimMappers[0]
+		}
+		if ext.KeyID != "" {
+			id = ext.KeyID
+		}
+	}
+	return mapper + "\x00" + id
+}
+
+// RateLimitInterceptor limits the request rate per claims subject (API key ID or JWT subject) with a token bucket.
+// The limit comes from the claims (per API key) or, for subjects without one, from subjectLimit.
+// It runs after the authorization interceptor, so the claims are already mapped.
+type RateLimitInterceptor struct {
+	logger       logpkg.Logger
+	subjectLimit *RateLimit
+	now          func() time.Time
+
+	mu        sync.Mutex
+	limiters  map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+// NewRateLimitInterceptor creates a RateLimitInterceptor, subjectLimit may be nil to only limit API keys with a limit
+func NewRateLimitInterceptor(subjectLimit *RateLimit, logger logpkg.Logger) *RateLimitInterceptor {
+	return &RateLimitInterceptor{
+		logger:       logger,
+		subjectLimit: subjectLimit,
+		now:          time.Now,
+		limiters:     make(map[string]*rate.Limiter),
+	}
+}
+
+// Intercept is a grpc.UnaryServerInterceptor, see temporal.WithChainedFrontendGrpcInterceptors
+func (i *RateLimitInterceptor) Intercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	claims, _ := ctx.Value(authorization.MappedClaims).(*authorization.Claims)
+	if retryAfter := i.reserve(claims); retryAfter > 0 {
+		i.logger.Warn("auth: rate limit exceeded",
+			tag.NewStringTag("subject", claims.Subject), tag.NewStringTag("api", info.FullMethod), tag.NewDurationTag("retry-after", retryAfter))
+		return nil, newRateLimitError(claims.Subject, retryAfter)
+	}
+	return handler(ctx, req)
+}
+
+// reserve takes a token from the subject's bucket, it returns how long to wait if there is none
+func (i *RateLimitInterceptor) reserve(claims *authorization.Claims) time.Duration {
+	limit := i.limitFor(claims)
+	if limit == nil {
+		return 0
+	}
+	now := i.now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.sweep(now)
+	key := rateLimitKey(claims)
+	limiter, ok := i.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit.RPS), limit.burst())
+		i.limiters[key] = limiter
+	} else if limiter.Limit() != rate.Limit(limit.RPS) || limiter.Burst() != limit.burst() {
+		// the key registry was reloaded with a new limit
+		limiter.SetLimitAt(now, rate.Limit(limit.RPS))
+		limiter.SetBurstAt(now, limit.burst())
+	}
+	r := limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// limitFor returns nil for callers which are not limited
+func (i *RateLimitInterceptor) limitFor(claims *authorization.Claims) *RateLimit {
+	if claims == nil || claims.Subject == "" {
+		return nil
+	}
+	limit := rateLimitOf(claims)
+	if limit == nil {
+		limit = i.subjectLimit
+	}
+	if limit == nil || limit.RPS == 0 {
+		return nil
+	}
+	return limit
+}
+
+// sweep drops limiters with a full bucket, they are in the same state as a new one
+func (i *RateLimitInterceptor) sweep(now time.Time) {
+	if now.Sub(i.lastSweep) < rateLimiterSweepInterval {
+		return
+	}
+	i.lastSweep = now
+	for key, limiter := range i.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(i.limiters, key)
+		}
+	}
+}
+
+// newRateLimitError is a ResourceExhausted status the SDKs retry, with the delay as a RetryInfo hint
+func newRateLimitError(subject string, retryAfter time.Duration) error {
+	retryAfter = max(retryAfter.Round(time.Millisecond), time.Millisecond)
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded for %s, retry after %v", subject, retryAfter))
+	if withDetails, err := st.WithDetails(
+		&errordetails.ResourceExhaustedFailure{Cause: enumspb.RESOURCE_EXHAUSTED_CAUSE_RPS_LIMIT},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -0,0 +1,181 @@
+package authorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/errordetails/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestRateLimitInterceptor(subjectLimit *RateLimit) (*RateLimitInterceptor, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)}
+	i := NewRateLimitInterceptor(subjectLimit, log.NewTestLogger())
+	i.now = clock.Now
+	return i, clock
+}
+
+func claimsWithRateLimit(subject string, limit *RateLimit) *authorization.Claims {
+	claims := &authorization.Claims{Subject: subject}
+	if limit != nil {
+		extensionsOf(claims).RateLimit = limit
+	}
+	return claims
+}
+
+// call runs the interceptor with claims as mapped by the authorization interceptor
+func call(i *RateLimitInterceptor, claims *authorization.Claims) error {
+	ctx := context.WithValue(context.Background(), authorization.MappedClaims, claims)
+	_, err := i.Intercept(ctx, nil, &grpc.UnaryServerInfo{FullMethod: apiStart}, func(context.Context, any) (any, error) {
+		return "ok", nil
+	})
+	return err
+}
+
+func TestRateLimitInterceptor_TokenBucket(t *testing.T) {
+	i, clock := newTestRateLimitInterceptor(nil)
+	claims := claimsWithRateLimit("ci-bot", &RateLimit{RPS: 2, Burst: 3})
+
+	for range 3 {
+		require.NoError(t, call(i, claims))
+	}
+	err := call(i, claims)
+	require.Error(t, err)
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Contains(t, st.Message(), "ci-bot")
+	require.Len(t, st.Details(), 2)
+	assert.Equal(t, enumspb.RESOURCE_EXHAUSTED_CAUSE_RPS_LIMIT, st.Details()[0].(*errordetails.ResourceExhaustedFailure).Cause)
+	assert.Equal(t, 500*time.Millisecond, st.Details()[1].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+
+	var resourceExhausted *serviceerror.ResourceExhausted
+	require.ErrorAs(t, serviceerror.FromStatus(st), &resourceExhausted, "SDKs see a ResourceExhausted error")
+
+	// a rejected call does not use up a token
+	clock.Advance(499 * time.Millisecond)
+	require.Error(t, call(i, claims))
+	clock.Advance(time.Millisecond)
+	require.NoError(t, call(i, claims))
+	require.Error(t, call(i, claims))
+
+	// the bucket refills up to the burst
+	clock.Advance(10 * time.Second)
+	for range 3 {
+		require.NoError(t, call(i, claims))
+	}
+	require.Error(t, call(i, claims))
+}
+
+func TestRateLimitInterceptor_PerSubject(t *testing.T) {
+	i, _ := newTestRateLimitInterceptor(nil)
+	limit := &RateLimit{RPS: 1}
+
+	require.NoError(t, call(i, claimsWithRateLimit("a", limit)))
+	require.Error(t, call(i, claimsWithRateLimit("a", limit)))
+	require.NoError(t, call(i, claimsWithRateLimit("b", limit)), "subjects have separate buckets")
+}
+
+func TestRateLimitInterceptor_PerClaimMapper(t *testing.T) {
+	i, _ := newTestRateLimitInterceptor(&RateLimit{RPS: 1})
+
+	key := claimsWithRateLimit("ci-bot", &RateLimit{RPS: 1})
+	extensionsOf(key).ClaimMappers = []string{"apiKeyClaimMapper"}
+	extensionsOf(key).KeyID = "ci-bot"
+	require.NoError(t, call(i, key))
+	require.Error(t, call(i, key))
+
+	// a JWT whose "sub" is the key ID has a bucket of its own
+	jwt := &authorization.Claims{Subject: "ci-bot"}
+	extensionsOf(jwt).ClaimMappers = []string{"defaultJWTClaimMapper"}
+	require.NoError(t, call(i, jwt))
+	require.Error(t, call(i, jwt))
+}
+
+func TestRateLimitInterceptor_SubjectLimit(t *testing.T) {
+	i, _ := newTestRateLimitInterceptor(&RateLimit{RPS: 1})
+
+	// a JWT subject without a limit of its own
+	jwt := &authorization.Claims{Subject: "user@example.com"}
+	require.NoError(t, call(i, jwt))
+	require.Error(t, call(i, jwt))
+
+	// an API key limit takes precedence, rps 0 is unlimited
+	for range 10 {
+		require.NoError(t, call(i, claimsWithRateLimit("own", &RateLimit{RPS: 100, Burst: 100})))
+		require.NoError(t, call(i, claimsWithRateLimit("unlimited", &RateLimit{})))
+	}
+
+	// calls without claims or subject are left to the authorizer
+	require.NoError(t, call(i, nil))
+	require.NoError(t, call(i, &authorization.Claims{}))
+	require.NoError(t, call(i, &authorization.Claims{}))
+}
+
+func TestRateLimitInterceptor_Unlimited(t *testing.T) {
+	i, _ := newTestRateLimitInterceptor(nil)
+	for range 100 {
+		require.NoError(t, call(i, &authorization.Claims{Subject: "user@example.com"}))
+	}
+	assert.Empty(t, i.limiters)
+}
+
+func TestRateLimitInterceptor_LimitChange(t *testing.T) {
+	i, clock := newTestRateLimitInterceptor(nil)
+	require.NoError(t, call(i, claimsWithRateLimit("k", &RateLimit{RPS: 1})))
+	require.Error(t, call(i, claimsWithRateLimit("k", &RateLimit{RPS: 1})))
+
+	// e.g. the key registry was reloaded with a higher limit, the bucket keeps its tokens and refills faster
+	require.Error(t, call(i, claimsWithRateLimit("k", &RateLimit{RPS: 5})))
+	clock.Advance(time.Second)
+	for range 5 {
+		require.NoError(t, call(i, claimsWithRateLimit("k", &RateLimit{RPS: 5})))
+	}
+	require.Error(t, call(i, claimsWithRateLimit("k", &RateLimit{RPS: 5})))
+}
+
+func TestRateLimitInterceptor_Sweep(t *testing.T) {
+	i, clock := newTestRateLimitInterceptor(nil)
+	require.NoError(t, call(i, claimsWithRateLimit("idle", &RateLimit{RPS: 1})))
+	require.Len(t, i.limiters, 1)
+
+	clock.Advance(2 * rateLimiterSweepInterval)
+	require.NoError(t, call(i, claimsWithRateLimit("busy", &RateLimit{RPS: 1})))
+	assert.Len(t, i.limiters, 1)
+	assert.Contains(t, i.limiters, "\x00busy")
+}
+
+func TestRateLimit_Burst(t *testing.T) {
+	assert.Equal(t, 1, (&RateLimit{RPS: 0.2}).burst())
+	assert.Equal(t, 3, (&RateLimit{RPS: 2.5}).burst())
+	assert.Equal(t, 7, (&RateLimit{RPS: 2.5, Burst: 7}).burst())
+}
+
+func TestMergeClaims_RateLimit(t *testing.T) {
+	limit := &RateLimit{RPS: 1}
+	jwt := &authorization.Claims{Subject: "user", System: authorization.RoleReader}
+	key := claimsWithRateLimit("key", limit)
+	key.System = authorization.RoleReader
+
+	assert.Same(t, limit, rateLimitOf(unionClaims(jwt, key)))
+	assert.Same(t, limit, rateLimitOf(intersectClaims(key, jwt)))
+	assert.Nil(t, rateLimitOf(unionClaims(jwt, jwt)))
+}
@@ -0,0 +1,58 @@
+package authorizer
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"time"
+
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+)
+
+// Reloader is implemented by claim mappers which can reload their configuration at runtime
+type Reloader interface {
+	Reload() error
+}
+
+// WatchReload calls reloader.Reload on every signal received and, if interval > 0,
+// when the content of path changes (polled, so it also follows ConfigMap symlink swaps).
+// It blocks until ctx is done.
+func WatchReload(ctx context.Context, reloader Reloader, signals <-chan os.Signal, path string, interval time.Duration, logger logpkg.Logger) {
+	var poll <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	last := fileDigest(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			logger.Info("auth: reload requested", tag.NewStringTag("signal", sig.String()))
+			last = fileDigest(path)
+			_ = reloader.Reload()
+		case <-poll:
+			digest := fileDigest(path)
+			if digest == last {
+				continue
+			}
+			logger.Info("auth: file change detected, reloading", tag.NewStringTag("path", path))
+			last = digest
+			_ = reloader.Reload()
+		}
+	}
+}
+
+// fileDigest returns the content digest, a missing file has the zero digest
+func fileDigest(path string) [sha256.Size]byte {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,124 @@
+package authorizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+)
+
+type countingReloader struct {
+	calls atomic.Int32
+}
+
+func (r *countingReloader) Reload() error {
+	r.calls.Add(1)
+	return nil
+}
+
+func writeKeysFile(t *testing.T, path, id, secret, role string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(`
+keys:
+  - id: `+id+`
+    secretHash: "$`+sha256Hash("salt", secret)+`"
+    namespaces: {orders: `+role+`}
+`), 0o600))
+}
+
+func TestWatchReload_Signal(t *testing.T) {
+	reloader := &countingReloader{}
+	signals := make(chan os.Signal)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchReload(ctx, reloader, signals, filepath.Join(t.TempDir(), "keys.yaml"), 0, log.NewTestLogger())
+		close(done)
+	}()
+
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGHUP
+	cancel()
+	<-done
+	assert.Equal(t, int32(2), reloader.calls.Load())
+}
+
+func TestWatchReload_FileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeysFile(t, path, "ci-bot", "s3cret", "write")
+	reloader := &countingReloader{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go WatchReload(ctx, reloader, nil, path, 5*time.Millisecond, log.NewTestLogger())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, int32(0), reloader.calls.Load(), "unchanged file must not reload")
+
+	writeKeysFile(t, path, "ci-bot", "s3cret", "read")
+	assert.Eventually(t, func() bool { return reloader.calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestAPIKeyClaimMapper_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeysFile(t, path, "ci-bot", "s3cret", "write")
+	mapper, err := NewAPIKeyFileClaimMapper(path, log.NewTestLogger())
+	require.NoError(t, err)
+	reloader, ok := mapper.(Reloader)
+	require.True(t, ok)
+
+	// rotate the key
+	writeKeysFile(t, path, "ci-bot2", "n3w", "read")
+	require.NoError(t, reloader.Reload())
+	claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot.s3cret"})
+	require.NoError(t, err)
+	assert.Nil(t, claims)
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot2.n3w"})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+	assert.Equal(t, authorization.RoleReader, claims.Namespaces["orders"])
+
+	// invalid file keeps the previous keys
+	require.NoError(t, os.WriteFile(path, []byte("keys: [{id: broken}]"), 0o600))
+	require.Error(t, reloader.Reload())
+	claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer ci-bot2.n3w"})
+	require.NoError(t, err)
+	require.NotNil(t, claims)
+}
+
+func TestAPIKeyClaimMapper_ReloadConcurrent(t *testing.T) {
+	var generation atomic.Int32
+	mapper, err := newAPIKeyClaimMapper(func() (*apiKeySet, error) {
+		if generation.Add(1)%3 == 0 {
+			return nil, errors.New("broken")
+		}
+		keys, err := parseAPIKeysString("k:read:ns1;k:write:ns2")
+		return &apiKeySet{keys: keys}, err
+	}, log.NewTestLogger())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			_ = mapper.Reload()
+		}
+	}()
+	for range 1000 {
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer k"})
+		require.NoError(t, err)
+		require.NotNil(t, claims)
+		require.Len(t, claims.Namespaces, 2)
+	}
+	wg.Wait()
+}
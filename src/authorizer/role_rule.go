@@ -0,0 +1,74 @@
+package authorizer
+
+import (
+	"fmt"
+
+	"go.temporal.io/server/common/authorization"
+)
+
+// roleRule grants roles to credentials with a matching attribute value, e.g. a JWT claim or a certificate field.
+// It is the validated form of JWTClaimRule and TLSClaimRule.
+type roleRule struct {
+	// attribute restricts the rule to one attribute, any of them if empty
+	attribute  string
+	value      string
+	system     authorization.Role
+	namespaces map[string]authorization.Role
+	patterns   []NamespacePattern
+}
+
+// newRoleRule validates the value and the roles of a rule, the attribute is validated by the caller
+func newRoleRule(attribute, value, system string, namespaces map[string]string) (*roleRule, error) {
+	if value == "" {
+		return nil, fmt.Errorf("value: required")
+	}
+	if system == "" && len(namespaces) == 0 {
+		return nil, fmt.Errorf("system: a system role or namespaces are required")
+	}
+	rule := &roleRule{attribute: attribute, value: value, namespaces: make(map[string]authorization.Role)}
+	var err error
+	if system != "" {
+		if rule.system, err = parseRole(system); err != nil {
+			return nil, fmt.Errorf("system: %w", err)
+		}
+	}
+	for namespace, permission := range namespaces {
+		if namespace == namespaceSystemDeprecated {
+			return nil, fmt.Errorf("namespaces.%s: %w", namespace, errAmbiguousNamespace)
+		}
+		role, err := parseRole(permission)
+		if err != nil {
+			return nil, fmt.Errorf("namespaces.%s: %w", namespace, err)
+		}
+		if namespace == namespaceSystem {
+			rule.system = max(rule.system, role)
+			continue
+		}
+		pattern, err := parseNamespacePattern(namespace, role)
+		if err != nil {
+			return nil, fmt.Errorf("namespaces.%s: %w", namespace, err)
+		}
+		if pattern != nil {
+			rule.patterns = append(rule.patterns, *pattern)
+			continue
+		}
+		rule.namespaces[namespace] = role
+	}
+	return rule, nil
+}
+
+func (r *roleRule) matches(attribute, value string) bool {
+	return (r.attribute == "" || r.attribute == attribute) && globMatch(r.value, value)
+}
+
+// grant adds the roles of the rule to claims, the highest role per namespace wins
+func (r *roleRule) grant(claims *authorization.Claims) {
+	claims.System = max(claims.System, r.system)
+	for namespace, role := range r.namespaces {
+		claims.Namespaces[namespace] = max(claims.Namespaces[namespace], role)
+	}
+	if len(r.patterns) > 0 {
+		ext := extensionsOf(claims)
+		ext.NamespacePatterns = append(ext.NamespacePatterns, r.patterns...)
+	}
+}
@@ -0,0 +1,96 @@
+package authorizer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+)
+
+const (
+	apiTerminate = "/temporal.api.workflowservice.v1.WorkflowService/TerminateWorkflowExecution"
+	apiStart     = "/temporal.api.workflowservice.v1.WorkflowService/StartWorkflowExecution"
+	apiDescribe  = "/temporal.api.workflowservice.v1.WorkflowService/DescribeWorkflowExecution"
+	apiHealth    = "/grpc.health.v1.Health/Check"
+)
+
+func TestRuleAuthorizer(t *testing.T) {
+	a, err := NewRuleAuthorizer([]AuthorizationRule{
+		{Name: "no-terminate", Subject: "ci-*", API: "*Terminate*", Effect: "deny"},
+		{Subject: "ops", Namespace: "prod-*", API: "TerminateWorkflowExecution", Effect: "allow"},
+		{Name: "ops-frozen", Subject: "ops", Namespace: "frozen", Effect: "allow"},
+		{Name: "everyone-sandbox", Namespace: "sandbox-*", Effect: "allow"},
+		{Namespace: "frozen", Effect: "deny"},
+	}, authorization.NewDefaultAuthorizer())
+	require.NoError(t, err)
+
+	writer := func(subject string) *authorization.Claims {
+		return &authorization.Claims{Subject: subject, Namespaces: map[string]authorization.Role{
+			"orders":   authorization.RoleWriter,
+			"prod-eu":  authorization.RoleReader,
+			"frozen":   authorization.RoleWriter,
+			"sandbox":  authorization.RoleWriter,
+			"prod-off": authorization.RoleWriter,
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		claims    *authorization.Claims
+		namespace string
+		api       string
+		decision  authorization.Decision
+		reason    string
+	}{
+		{"deny rule", writer("ci-bot"), "orders", apiTerminate, authorization.DecisionDeny, "denied by authorization rule no-terminate"},
+		{"no rule matches, default allows", writer("ci-bot"), "orders", apiStart, authorization.DecisionAllow, ""},
+		{"other subject, default allows", writer("app"), "orders", apiTerminate, authorization.DecisionAllow, ""},
+		{"allow rule, default allows", writer("ops"), "prod-off", apiTerminate, authorization.DecisionAllow, ""},
+		{"allow rule cannot grant beyond the role", writer("ops"), "prod-eu", apiTerminate, authorization.DecisionDeny, ""},
+		{"allow rule for anyone cannot grant a namespace", writer("app"), "sandbox-x", apiDescribe, authorization.DecisionDeny, ""},
+		{"allow rule skips later deny rules", writer("ops"), "frozen", apiDescribe, authorization.DecisionAllow, ""},
+		{"other namespace", writer("ops"), "orders", apiTerminate, authorization.DecisionAllow, ""},
+		{"unnamed deny rule", writer("app"), "frozen", apiDescribe, authorization.DecisionDeny, "denied by authorization rule #4"},
+		{"default denies", writer("app"), "unknown", apiStart, authorization.DecisionDeny, ""},
+		{"health check always passes", writer("app"), "frozen", apiHealth, authorization.DecisionAllow, ""},
+		{"no subject, deny rule for anyone", writer(""), "frozen", apiDescribe, authorization.DecisionDeny, "denied by authorization rule #4"},
+		{"no subject, no rule matches", writer(""), "orders", apiTerminate, authorization.DecisionAllow, ""},
+		{"nil claims go to default", nil, "orders", apiStart, authorization.DecisionDeny, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := a.Authorize(context.Background(), tc.claims, &authorization.CallTarget{APIName: tc.api, Namespace: tc.namespace})
+			require.NoError(t, err)
+			assert.Equal(t, tc.decision, result.Decision)
+			assert.Equal(t, tc.reason, result.Reason)
+		})
+	}
+}
+
+func TestRuleAuthorizer_NoSubject(t *testing.T) {
+	a, err := NewRuleAuthorizer([]AuthorizationRule{
+		{Name: "authenticated-frozen", Subject: "*", Namespace: "frozen", Effect: "deny"},
+		{Name: "no-delete", API: "DeleteNamespace", Effect: "deny"},
+	}, authorization.NewDefaultAuthorizer())
+	require.NoError(t, err)
+
+	// e.g. claims of an mTLS mapping without a CN or of claimMapperPolicies grants
+	admin := &authorization.Claims{System: authorization.RoleAdmin}
+	result, err := a.Authorize(context.Background(), admin, &authorization.CallTarget{APIName: "/temporal.api.operatorservice.v1.OperatorService/DeleteNamespace"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.DecisionDeny, result.Decision)
+	assert.Equal(t, "denied by authorization rule no-delete", result.Reason)
+
+	// a subject rule, even "*", does not match claims without a subject
+	writer := &authorization.Claims{Namespaces: map[string]authorization.Role{"frozen": authorization.RoleWriter}}
+	result, err = a.Authorize(context.Background(), writer, &authorization.CallTarget{APIName: apiDescribe, Namespace: "frozen"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.DecisionAllow, result.Decision)
+}
+
+func TestNewRuleAuthorizer_Invalid(t *testing.T) {
+	_, err := NewRuleAuthorizer([]AuthorizationRule{{Effect: "allow"}, {Effect: "block"}}, authorization.NewDefaultAuthorizer())
+	require.ErrorContains(t, err, "authorizationRules[1]: effect:")
+}
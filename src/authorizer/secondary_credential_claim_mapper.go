@@ -0,0 +1,190 @@
+package authorizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+)
+
+// DefaultJWTClaimMapperName is the name the server registers Temporal's default JWT claim mapper with
+const DefaultJWTClaimMapperName = "defaultJWTClaimMapper"
+
+// SecondaryCredentialRequire decides which of the primary and the secondary credential must be recognized
+type SecondaryCredentialRequire string
+
+const (
+	// SecondaryRequireBoth denies requests with a recognized primary credential unless the secondary is recognized too,
+	// only the roles both grant are kept. The request is denied even if a claim mapper after this one would accept
+	// the primary credential alone, and so is a primary credential the primary claim mapper fails to verify; requests
+	// the primary claim mapper does not recognize, e.g. an API key for a JWT claim mapper, are left to the other
+	// claim mappers.
+	SecondaryRequireBoth SecondaryCredentialRequire = "both"
+	// SecondaryRequireEither accepts either credential alone, the highest role of both is kept
+	SecondaryRequireEither SecondaryCredentialRequire = "either"
+)
+
+type (
+	// SecondaryCredential checks a second credential sent in the "Authorization-Extras" header (AuthInfo.ExtraData)
+	// with a registered claim mapper, e.g. a service API key along with the user JWT in "Authorization"
+	SecondaryCredential struct {
+		// Primary is the registered claim mapper checking "Authorization", it is replaced by the combined mapper
+		Primary string `yaml:"primary"`
+		// Secondary is the registered claim mapper checking "Authorization-Extras"
+		Secondary string `yaml:"secondary"`
+		// Require is both or either, default both
+		Require SecondaryCredentialRequire `yaml:"require"`
+	}
+
+	secondaryCredentialClaimMapper struct {
+		primary   authorization.ClaimMapper
+		secondary authorization.ClaimMapper
+		require   SecondaryCredentialRequire
+		// jwtPrimary is set for Temporal's default JWT claim mapper, which fails on any bearer token that is not a JWT
+		jwtPrimary bool
+		logger     logpkg.Logger
+	}
+)
+
+func (c *SecondaryCredential) validate() error {
+	switch {
+	case c.Primary == "":
+		return fmt.Errorf("primary: required")
+	case c.Secondary == "":
+		return fmt.Errorf("secondary: required")
+	case c.Primary == c.Secondary:
+		return fmt.Errorf("secondary: must not be the primary claim-mapper %q", c.Primary)
+	}
+	if _, err := c.require(); err != nil {
+		return fmt.Errorf("require: %w", err)
+	}
+	return nil
+}
+
+func (c *SecondaryCredential) require() (SecondaryCredentialRequire, error) {
+	switch r := SecondaryCredentialRequire(strings.ToLower(string(c.Require))); r {
+	case "":
+		return SecondaryRequireBoth, nil
+	case SecondaryRequireBoth, SecondaryRequireEither:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown value %q - expected %s or %s", c.Require, SecondaryRequireBoth, SecondaryRequireEither)
+}
+
+// RequiresBoth reports whether both credentials must be recognized, the default
+func (c *SecondaryCredential) RequiresBoth() bool {
+	r, _ := c.require()
+	return r == SecondaryRequireBoth
+}
+
+// validateSecondaryCredentials checks every entry and that no claim-mapper is the primary of two entries
+func validateSecondaryCredentials(credentials []SecondaryCredential) error {
+	primaries := make(map[string]bool, len(credentials))
+	for i := range credentials {
+		if err := credentials[i].validate(); err != nil {
+			return fmt.Errorf("secondaryCredentials[%d].%w", i, err)
+		}
+		if primaries[credentials[i].Primary] {
+			return fmt.Errorf("secondaryCredentials[%d].primary: %q is configured twice", i, credentials[i].Primary)
+		}
+		primaries[credentials[i].Primary] = true
+	}
+	return nil
+}
+
+// NewSecondaryCredentialClaimMapper creates a claim mapper which checks AuthInfo.AuthToken with primary and
+// AuthInfo.ExtraData with secondary, any claim mapper can check either credential (API key, JWT, opaque token).
+// The combined claims have the subject of the primary credential, ClaimsExtensions.Subjects holds both.
+func NewSecondaryCredentialClaimMapper(primary, secondary authorization.ClaimMapper, credential SecondaryCredential, logger logpkg.Logger) (authorization.ClaimMapper, error) {
+	if err := credential.validate(); err != nil {
+		return nil, err
+	}
+	require, _ := credential.require()
+	return &secondaryCredentialClaimMapper{primary: primary, secondary: secondary, require: require,
+		jwtPrimary: credential.Primary == DefaultJWTClaimMapperName, logger: logger}, nil
+}
+
+// GetClaims asks both claim mappers; a credential which is sent but rejected fails the request with either policy.
+// With SecondaryRequireBoth a primary credential which fails verification, or a recognized one without a recognized
+// secondary one, is a terminal error, so no claim mapper after this one can accept either credential alone. Requests
+// with a primary credential the primary claim mapper does not recognize, e.g. of services with an API key only or of
+// workers with mTLS certificates, are left to the other claim mappers.
+func (m *secondaryCredentialClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
+	if authInfo == nil {
+		return nil, nil
+	}
+	primary, err := m.primary.GetClaims(authInfo)
+	if err != nil {
+		if m.unrecognized(authInfo, err) {
+			m.logger.Debug("auth: secondary credential: primary credential not recognized", tag.Error(err))
+			return nil, nil
+		}
+		return nil, m.rejected(err)
+	}
+	if m.require == SecondaryRequireBoth && !hasClaims(primary) {
+		return nil, nil
+	}
+	var secondary *authorization.Claims
+	if authInfo.ExtraData != "" {
+		if secondary, err = m.secondary.GetClaims(secondaryAuthInfo(authInfo)); err != nil {
+			return nil, m.rejected(err)
+		}
+	}
+
+	switch {
+	case hasClaims(primary) && hasClaims(secondary):
+		claims := cloneClaims(primary)
+		if m.require == SecondaryRequireBoth {
+			claims = intersectClaims(claims, secondary)
+			if !hasClaims(claims) {
+				return nil, newTerminalError(withReason(reasonSecondaryCredential,
+					serviceerror.NewPermissionDenied("the primary and the secondary credential have no permission in common", "")))
+			}
+		} else {
+			claims = unionClaims(claims, secondary)
+		}
+		extensionsOf(claims).Subjects = []string{primary.Subject, secondary.Subject}
+		m.logger.Debug("auth: secondary credential combined", tag.NewStringsTag("subjects", extensionsOf(claims).Subjects),
+			tag.NewStringTag("require", string(m.require)))
+		return claims, nil
+	case m.require == SecondaryRequireBoth:
+		m.logger.Debug("auth: secondary credential: both credentials are required", tag.NewStringTag("subject", primary.Subject))
+		return nil, newTerminalError(withReason(reasonSecondaryCredential,
+			serviceerror.NewPermissionDenied("both the primary and the secondary credential are required", "")))
+	case hasClaims(primary):
+		return primary, nil
+	case hasClaims(secondary):
+		return secondary, nil
+	}
+	return nil, nil
+}
+
+// unrecognized reports whether the primary claim mapper failed because the credential is not of its kind
+// rather than because it failed verification
+func (m *secondaryCredentialClaimMapper) unrecognized(authInfo *authorization.AuthInfo, err error) bool {
+	return errors.Is(err, errNotJWT) || (m.jwtPrimary && !isJWT(authInfo.AuthToken))
+}
+
+// rejected makes err terminal if both credentials are required
+func (m *secondaryCredentialClaimMapper) rejected(err error) error {
+	if m.require == SecondaryRequireBoth && !isTerminalError(err) {
+		return newTerminalError(err)
+	}
+	return err
+}
+
+// secondaryAuthInfo swaps AuthToken and ExtraData so a claim mapper checks the secondary credential,
+// a credential without a scheme is a bearer token
+func secondaryAuthInfo(authInfo *authorization.AuthInfo) *authorization.AuthInfo {
+	alt := *authInfo
+	alt.AuthToken = authInfo.ExtraData
+	if !strings.Contains(alt.AuthToken, " ") {
+		alt.AuthToken = authorizationBearer + " " + alt.AuthToken
+	}
+	alt.ExtraData = authInfo.AuthToken
+	return &alt
+}
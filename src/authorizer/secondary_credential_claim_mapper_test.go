@@ -0,0 +1,217 @@
+package authorizer
+
+import (
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/config"
+	"go.temporal.io/server/common/log"
+)
+
+func TestSecondaryCredentialClaimMapper_GetClaims(t *testing.T) {
+	logger := log.NewTestLogger()
+	key := newTestRSAKey(t)
+	userMapper, err := NewJWTRoleClaimMapper(&testKeyProvider{rsaKeys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}, JWTClaimMapping{
+		Rules: []JWTClaimRule{{Value: "team-x-devs", Namespaces: map[string]string{"orders": "admin", "billing": "read"}}},
+	}, logger)
+	require.NoError(t, err)
+	serviceMapper, err := NewAPIKeyClaimMapper("svc:write:orders;reports:read:reports", logger)
+	require.NoError(t, err)
+	userJWT := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "groups": []string{"team-x-devs"}})
+
+	newMapper := func(require SecondaryCredentialRequire) authorization.ClaimMapper {
+		m, err := NewSecondaryCredentialClaimMapper(userMapper, serviceMapper,
+			SecondaryCredential{Primary: "jwtRoleClaimMapper", Secondary: "apiKeyClaimMapper", Require: require}, logger)
+		assert.NoError(t, err)
+		return m
+	}
+
+	t.Run("both", func(t *testing.T) {
+		mapper := newMapper(SecondaryRequireBoth)
+
+		// the service only writes to orders on behalf of the user
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: userJWT, ExtraData: "svc"})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", claims.Subject)
+		assert.Equal(t, []string{"alice", plaintextID("svc")}, extensionsOf(claims).Subjects)
+		assert.Equal(t, map[string]authorization.Role{"orders": authorization.RoleWriter}, claims.Namespaces)
+
+		for _, authInfo := range []*authorization.AuthInfo{
+			{AuthToken: userJWT},
+			{AuthToken: userJWT, ExtraData: "unknown"},
+			// no role both grant
+			{AuthToken: userJWT, ExtraData: "Bearer reports"},
+		} {
+			claims, err := mapper.GetClaims(authInfo)
+			require.Error(t, err, authInfo.ExtraData)
+			assert.True(t, isTerminalError(err), authInfo.ExtraData)
+			assert.Nil(t, claims)
+		}
+
+		// without a recognized primary credential the request is left to the other claim mappers
+		for _, authInfo := range []*authorization.AuthInfo{
+			{AuthToken: "Bearer svc", ExtraData: "svc"},
+			{ExtraData: "svc"},
+			{},
+		} {
+			claims, err := mapper.GetClaims(authInfo)
+			require.NoError(t, err, authInfo.AuthToken)
+			assert.Nil(t, claims)
+		}
+	})
+
+	t.Run("either", func(t *testing.T) {
+		mapper := newMapper(SecondaryRequireEither)
+
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{AuthToken: userJWT, ExtraData: "Bearer reports"})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", claims.Subject)
+		assert.Equal(t, []string{"alice", plaintextID("reports")}, extensionsOf(claims).Subjects)
+		assert.Equal(t, authorization.RoleAdmin, claims.Namespaces["orders"])
+		assert.Equal(t, authorization.RoleReader, claims.Namespaces["reports"])
+
+		claims, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: userJWT})
+		require.NoError(t, err)
+		assert.Equal(t, "alice", claims.Subject)
+		assert.Nil(t, claims.Extensions)
+
+		claims, err = mapper.GetClaims(&authorization.AuthInfo{ExtraData: "svc"})
+		require.NoError(t, err)
+		assert.Equal(t, plaintextID("svc"), claims.Subject)
+	})
+
+	t.Run("rejected credential", func(t *testing.T) {
+		expired := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()})
+		for _, r := range []SecondaryCredentialRequire{SecondaryRequireBoth, SecondaryRequireEither} {
+			_, err := newMapper(r).GetClaims(&authorization.AuthInfo{AuthToken: expired, ExtraData: "svc"})
+			require.ErrorContains(t, err, "expired", r)
+			assert.Equal(t, r == SecondaryRequireBoth, isTerminalError(err), r)
+
+			// the user JWT as secondary credential
+			mapper, err := NewSecondaryCredentialClaimMapper(serviceMapper, userMapper,
+				SecondaryCredential{Primary: "apiKeyClaimMapper", Secondary: "jwtRoleClaimMapper", Require: r}, logger)
+			require.NoError(t, err)
+			_, err = mapper.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer svc", ExtraData: expired})
+			require.ErrorContains(t, err, "expired", r)
+		}
+	})
+}
+
+func TestSecondaryCredentialClaimMapper_RequireBothStopsChain(t *testing.T) {
+	logger := log.NewTestLogger()
+	key := newTestRSAKey(t)
+	userMapper, err := NewJWTRoleClaimMapper(&testKeyProvider{rsaKeys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}, JWTClaimMapping{
+		Rules: []JWTClaimRule{{Value: "team-x-devs", Namespaces: map[string]string{"orders": "admin"}}},
+	}, logger)
+	require.NoError(t, err)
+	serviceMapper, err := NewAPIKeyClaimMapper("svc:write:orders", logger)
+	require.NoError(t, err)
+	userJWT := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "groups": []string{"team-x-devs"}})
+
+	m := NewMultiClaimMapper(logger)
+	m.Add("jwtRoleClaimMapper", userMapper)
+	m.Add("apiKeyClaimMapper", serviceMapper)
+	combined, err := NewSecondaryCredentialClaimMapper(userMapper, serviceMapper,
+		SecondaryCredential{Primary: "jwtRoleClaimMapper", Secondary: "apiKeyClaimMapper"}, logger)
+	require.NoError(t, err)
+	m.Add("jwtRoleClaimMapper", combined)
+
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: userJWT, ExtraData: "svc"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.RoleWriter, claims.Namespaces["orders"])
+
+	// the user JWT is recognized, so it is not accepted without the API key
+	for _, authInfo := range []*authorization.AuthInfo{
+		{AuthToken: userJWT},
+		{AuthToken: userJWT, ExtraData: "unknown"},
+	} {
+		claims, err := m.GetClaims(authInfo)
+		require.ErrorContains(t, err, "both the primary and the secondary credential are required", authInfo.ExtraData)
+		assert.Nil(t, claims)
+	}
+
+	// callers without the user JWT, e.g. services with an API key only, are left to the other claim mappers
+	claims, err = m.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer svc"})
+	require.NoError(t, err)
+	assert.Equal(t, plaintextID("svc"), claims.Subject)
+}
+
+func TestSecondaryCredentialClaimMapper_RequireBothDefaultJWTPrimary(t *testing.T) {
+	logger := log.NewTestLogger()
+	key := newTestRSAKey(t)
+	keyProvider := &testKeyProvider{rsaKeys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}}
+	authCfg := &config.Authorization{PermissionsClaimName: "permissions"}
+	jwtMapper := authorization.NewDefaultJWTClaimMapper(keyProvider, authCfg, logger)
+	serviceMapper, err := NewAPIKeyClaimMapper("svc:write:orders", logger)
+	require.NoError(t, err)
+	userJWT := signTestJWT(t, key, "k1", jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "permissions": []string{"orders:admin"}})
+	otherKey := newTestRSAKey(t)
+	forgedJWT := signTestJWT(t, otherKey, "k1", jwt.MapClaims{"sub": "mallory", "exp": time.Now().Add(time.Hour).Unix(), "permissions": []string{"orders:admin"}})
+
+	m := NewMultiClaimMapper(logger)
+	m.Add(DefaultJWTClaimMapperName, jwtMapper)
+	m.Add("extraDataJWTClamMapper", NewExtraDataJWTClamMapper(jwtMapper, logger))
+	m.Add("apiKeyClaimMapper", serviceMapper)
+	combined, err := NewSecondaryCredentialClaimMapper(jwtMapper, serviceMapper,
+		SecondaryCredential{Primary: DefaultJWTClaimMapperName, Secondary: "apiKeyClaimMapper"}, logger)
+	require.NoError(t, err)
+	m.Add(DefaultJWTClaimMapperName, combined)
+	// extraDataJWTClamMapper would accept the user JWT in "Authorization-Extras" alone, the server removes it
+	require.True(t, m.Remove("extraDataJWTClamMapper"))
+
+	claims, err := m.GetClaims(&authorization.AuthInfo{AuthToken: userJWT, ExtraData: "svc"})
+	require.NoError(t, err)
+	assert.Equal(t, authorization.RoleWriter, claims.Namespaces["orders"])
+
+	// an API key is not a JWT, the default JWT claim mapper does not recognize it and the API key claim mapper accepts it
+	claims, err = m.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer svc"})
+	require.NoError(t, err)
+	assert.Equal(t, plaintextID("svc"), claims.Subject)
+
+	// junk in "Authorization" does not get the user JWT in "Authorization-Extras" accepted
+	claims, err = m.GetClaims(&authorization.AuthInfo{AuthToken: "Bearer x", ExtraData: userJWT})
+	require.NoError(t, err)
+	assert.False(t, hasClaims(claims))
+
+	// a JWT which fails verification stops the chain
+	claims, err = m.GetClaims(&authorization.AuthInfo{AuthToken: forgedJWT, ExtraData: "svc"})
+	require.Error(t, err)
+	assert.True(t, isTerminalError(err))
+	assert.Nil(t, claims)
+}
+
+func TestSecondaryAuthInfo(t *testing.T) {
+	authInfo := &authorization.AuthInfo{AuthToken: "Bearer user", ExtraData: "svc", Audience: "temporal"}
+	alt := secondaryAuthInfo(authInfo)
+	assert.Equal(t, &authorization.AuthInfo{AuthToken: "bearer svc", ExtraData: "Bearer user", Audience: "temporal"}, alt)
+	assert.Equal(t, "svc", authInfo.ExtraData)
+
+	assert.Equal(t, "Basic dXNlcjpwYXNz", secondaryAuthInfo(&authorization.AuthInfo{ExtraData: "Basic dXNlcjpwYXNz"}).AuthToken)
+}
+
+func TestValidateSecondaryCredentials(t *testing.T) {
+	valid := SecondaryCredential{Primary: "jwtIssuerClaimMapper", Secondary: "apiKeyFileClaimMapper"}
+	tests := []struct {
+		name        string
+		credentials []SecondaryCredential
+		wantErr     string
+	}{
+		{"no primary", []SecondaryCredential{{Secondary: "apiKeyFileClaimMapper"}}, "secondaryCredentials[0].primary: required"},
+		{"no secondary", []SecondaryCredential{{Primary: "jwtIssuerClaimMapper"}}, "secondaryCredentials[0].secondary: required"},
+		{"same mapper", []SecondaryCredential{{Primary: "apiKeyFileClaimMapper", Secondary: "apiKeyFileClaimMapper"}}, "secondaryCredentials[0].secondary: must not be the primary"},
+		{"unknown require", []SecondaryCredential{{Primary: "a", Secondary: "b", Require: "all"}}, `secondaryCredentials[0].require: unknown value "all"`},
+		{"duplicate primary", []SecondaryCredential{valid, valid}, `secondaryCredentials[1].primary: "jwtIssuerClaimMapper" is configured twice`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require.ErrorContains(t, validateSecondaryCredentials(tc.credentials), tc.wantErr)
+		})
+	}
+
+	require.NoError(t, validateSecondaryCredentials([]SecondaryCredential{valid, {Primary: "defaultJWTClaimMapper", Secondary: "apiKeyClaimMapper", Require: "Either"}}))
+}
@@ -0,0 +1,143 @@
+package authorizer
+
+import (
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.temporal.io/server/common/authorization"
+	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/log/tag"
+)
+
+// Certificate attributes TLSClaimRule can match
+const (
+	tlsAttributeCN     = "cn"
+	tlsAttributeOU     = "ou"
+	tlsAttributeO      = "o"
+	tlsAttributeDNS    = "dns"
+	tlsAttributeURI    = "uri"
+	tlsAttributeSPIFFE = "spiffe"
+)
+
+var tlsAttributes = []string{tlsAttributeCN, tlsAttributeOU, tlsAttributeO, tlsAttributeDNS, tlsAttributeURI, tlsAttributeSPIFFE}
+
+type (
+	// TLSClaimMapping maps attributes of verified mTLS client certificates to Temporal roles
+	TLSClaimMapping struct {
+		// Rules are all checked, the highest role per namespace wins
+		Rules []TLSClaimRule `yaml:"rules"`
+	}
+
+	// TLSClaimRule grants roles to certificates with a matching attribute
+	TLSClaimRule struct {
+		// Attribute is cn, ou, o (subject), dns, uri (subject alternative names) or spiffe (the SPIFFE ID URI SAN)
+		Attribute string `yaml:"attribute"`
+		// Value is a glob ("*" any characters, "?" one character), e.g. "spiffe://example.org/ns/team-x/*"
+		Value string `yaml:"value"`
+		// System is the system role granted
+		System string `yaml:"system"`
+		// Namespaces maps namespaces to roles, a namespace may be a glob, an anchored /regex/ or "@all"
+		Namespaces map[string]string `yaml:"namespaces"`
+	}
+
+	tlsClaimMapper struct {
+		// rules match a certificate attribute name and value
+		rules  []roleRule
+		logger logpkg.Logger
+	}
+)
+
+func (m *TLSClaimMapping) compile() ([]roleRule, error) {
+	if len(m.Rules) == 0 {
+		return nil, fmt.Errorf("rules: at least one rule is required")
+	}
+	rules := make([]roleRule, 0, len(m.Rules))
+	for i, r := range m.Rules {
+		rule, err := r.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d].%w", i, err)
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, nil
+}
+
+func (r *TLSClaimRule) compile() (*roleRule, error) {
+	attribute := strings.ToLower(r.Attribute)
+	if attribute == "" {
+		return nil, fmt.Errorf("attribute: required")
+	}
+	if !slices.Contains(tlsAttributes, attribute) {
+		return nil, fmt.Errorf("attribute: unknown attribute %q - expected one of %s", r.Attribute, strings.Join(tlsAttributes, ", "))
+	}
+	return newRoleRule(attribute, r.Value, r.System, r.Namespaces)
+}
+
+// NewTLSClaimMapper creates a claim mapper which grants roles by the attributes of the verified mTLS client
+// certificate. The subject is the SPIFFE ID of the certificate, its common name otherwise.
+func NewTLSClaimMapper(mapping TLSClaimMapping, logger logpkg.Logger) (authorization.ClaimMapper, error) {
+	rules, err := mapping.compile()
+	if err != nil {
+		return nil, err
+	}
+	return &tlsClaimMapper{rules: rules, logger: logger}, nil
+}
+
+// GetClaims applies every rule matching an attribute of the client certificate.
+// Requests without a verified client certificate are skipped, a certificate no rule matches yields claims without roles.
+func (m *tlsClaimMapper) GetClaims(authInfo *authorization.AuthInfo) (*authorization.Claims, error) {
+	if authInfo == nil {
+		return nil, nil
+	}
+	// only certificates verified by the TLS handshake, never the unverified peer certificates
+	cert := authorization.PeerCert(authInfo.TLSConnection)
+	if cert == nil {
+		return nil, nil
+	}
+	attributes := certificateAttributes(cert)
+	claims := &authorization.Claims{Subject: certificateSubject(cert, attributes), Namespaces: make(map[string]authorization.Role)}
+	for _, name := range tlsAttributes {
+		for _, value := range attributes[name] {
+			for i := range m.rules {
+				if m.rules[i].matches(name, value) {
+					m.rules[i].grant(claims)
+				}
+			}
+		}
+	}
+	m.logger.Debug("auth: client certificate roles mapped", tag.NewStringTag("subject", claims.Subject),
+		tag.NewStringTag("claims", fmt.Sprintf("sys:%v,ns:%v", claims.System, claims.Namespaces)))
+	return claims, nil
+}
+
+// certificateAttributes returns the values of every tlsAttributes of cert
+func certificateAttributes(cert *x509.Certificate) map[string][]string {
+	attributes := map[string][]string{
+		tlsAttributeOU:  cert.Subject.OrganizationalUnit,
+		tlsAttributeO:   cert.Subject.Organization,
+		tlsAttributeDNS: cert.DNSNames,
+	}
+	if cert.Subject.CommonName != "" {
+		attributes[tlsAttributeCN] = []string{cert.Subject.CommonName}
+	}
+	for _, uri := range cert.URIs {
+		attributes[tlsAttributeURI] = append(attributes[tlsAttributeURI], uri.String())
+		if strings.EqualFold(uri.Scheme, "spiffe") {
+			attributes[tlsAttributeSPIFFE] = append(attributes[tlsAttributeSPIFFE], uri.String())
+		}
+	}
+	return attributes
+}
+
+// certificateSubject is the SPIFFE ID, the common name or the distinguished name of cert, in this order
+func certificateSubject(cert *x509.Certificate, attributes map[string][]string) string {
+	if spiffe := attributes[tlsAttributeSPIFFE]; len(spiffe) > 0 {
+		return spiffe[0]
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
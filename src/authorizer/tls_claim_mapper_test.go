@@ -0,0 +1,160 @@
+package authorizer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/server/common/authorization"
+	"go.temporal.io/server/common/log"
+	"google.golang.org/grpc/credentials"
+)
+
+// testCA issues client and server certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// mtlsHandshake connects a client with clientCert to a server requiring client certificates of ca,
+// and returns the TLS info of the server side like the gRPC transport credentials do
+func mtlsHandshake(t *testing.T, ca *testCA, clientCert tls.Certificate) *credentials.TLSInfo {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	server := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, &x509.Certificate{DNSNames: []string{"temporal"}})},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	client := tls.Client(clientConn, &tls.Config{Certificates: []tls.Certificate{clientCert}, RootCAs: pool, ServerName: "temporal"})
+	errs := make(chan error, 1)
+	go func() { errs <- client.Handshake() }()
+	require.NoError(t, server.Handshake())
+	require.NoError(t, <-errs)
+	return &credentials.TLSInfo{State: server.ConnectionState()}
+}
+
+func TestTLSClaimMapper_GetClaims(t *testing.T) {
+	ca := newTestCA(t)
+	mapper, err := NewTLSClaimMapper(TLSClaimMapping{Rules: []TLSClaimRule{
+		{Attribute: "spiffe", Value: "spiffe://example.org/ns/team-x/*", Namespaces: map[string]string{"team-x-*": "worker"}},
+		{Attribute: "OU", Value: "platform", System: "read"},
+		{Attribute: "cn", Value: "ops-admin", System: "admin"},
+		{Attribute: "dns", Value: "*.billing.svc", Namespaces: map[string]string{"billing": "write"}},
+		{Attribute: "uri", Value: "https://example.org/*", Namespaces: map[string]string{"billing": "read"}},
+	}}, log.NewTestLogger())
+	require.NoError(t, err)
+	spiffeID, _ := url.Parse("spiffe://example.org/ns/team-x/sa/worker")
+	website, _ := url.Parse("https://example.org/billing")
+
+	t.Run("spiffe id", func(t *testing.T) {
+		cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "worker", OrganizationalUnit: []string{"platform"}}, URIs: []*url.URL{spiffeID}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{TLSConnection: mtlsHandshake(t, ca, cert)})
+		require.NoError(t, err)
+		assert.Equal(t, spiffeID.String(), claims.Subject)
+		assert.Equal(t, authorization.RoleReader, claims.System)
+		assert.Equal(t, authorization.RoleWorker, namespacePatternRole(claims, "team-x-prod"))
+		assert.Equal(t, authorization.RoleUndefined, namespacePatternRole(claims, "team-y-prod"))
+	})
+
+	t.Run("common name and sans", func(t *testing.T) {
+		cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ops-admin"}, DNSNames: []string{"api.billing.svc"}, URIs: []*url.URL{website}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{TLSConnection: mtlsHandshake(t, ca, cert)})
+		require.NoError(t, err)
+		assert.Equal(t, "ops-admin", claims.Subject)
+		assert.Equal(t, authorization.RoleAdmin, claims.System)
+		assert.Equal(t, map[string]authorization.Role{"billing": authorization.RoleWriter}, claims.Namespaces)
+	})
+
+	t.Run("no rule matches", func(t *testing.T) {
+		cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{Organization: []string{"example"}, Country: []string{"DE"}}})
+		claims, err := mapper.GetClaims(&authorization.AuthInfo{TLSConnection: mtlsHandshake(t, ca, cert)})
+		require.NoError(t, err)
+		assert.False(t, hasClaims(claims))
+		assert.Equal(t, "O=example,C=DE", claims.Subject)
+	})
+
+	t.Run("no verified certificate", func(t *testing.T) {
+		cert := ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ops-admin"}})
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		for _, authInfo := range []*authorization.AuthInfo{
+			nil,
+			{AuthToken: "Bearer ci-bot.s3cret"},
+			// e.g. tls.RequestClientCert, the certificate is not verified
+			{TLSSubject: &leaf.Subject, TLSConnection: &credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}}},
+		} {
+			claims, err := mapper.GetClaims(authInfo)
+			require.NoError(t, err)
+			assert.Nil(t, claims)
+		}
+	})
+}
+
+func TestTLSClaimMapping_Compile(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping TLSClaimMapping
+		wantErr string
+	}{
+		{"no rules", TLSClaimMapping{}, "rules: at least one rule is required"},
+		{"no attribute", TLSClaimMapping{Rules: []TLSClaimRule{{Value: "w", System: "read"}}}, "rules[0].attribute: required"},
+		{"unknown attribute", TLSClaimMapping{Rules: []TLSClaimRule{{Attribute: "email", Value: "w", System: "read"}}}, `rules[0].attribute: unknown attribute "email"`},
+		{"no value", TLSClaimMapping{Rules: []TLSClaimRule{{Attribute: "cn", System: "read"}}}, "rules[0].value: required"},
+		{"no grant", TLSClaimMapping{Rules: []TLSClaimRule{{Attribute: "cn", Value: "w"}}}, "rules[0].system: a system role or namespaces are required"},
+		{"unknown role", TLSClaimMapping{Rules: []TLSClaimRule{{Attribute: "cn", Value: "w", Namespaces: map[string]string{"orders": "root"}}}}, `rules[0].namespaces.orders: unknown role "root"`},
+		{"bare wildcard", TLSClaimMapping{Rules: []TLSClaimRule{{Attribute: "cn", Value: "w", Namespaces: map[string]string{"*": "admin"}}}}, `rules[0].namespaces.*: ambiguous, use "@all"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.mapping.compile()
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package authorizer
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	"go.temporal.io/server/common/authorization"
@@ -15,20 +17,143 @@ const (
 	permissionAdmin  = "admin"
 )
 
-func permissionToRole(permission string) authorization.Role {
-	switch strings.ToLower(permission) {
-	case permissionRead:
-		return authorization.RoleReader
-	case permissionWrite:
-		return authorization.RoleWriter
-	case permissionAdmin:
-		return authorization.RoleAdmin
-	case permissionWorker:
-		return authorization.RoleWorker
+// permissionRoles are the accepted role names, the documented aliases included
+var permissionRoles = map[string]authorization.Role{
+	permissionRead:   authorization.RoleReader,
+	"reader":         authorization.RoleReader,
+	"ro":             authorization.RoleReader,
+	permissionWrite:  authorization.RoleWriter,
+	"writer":         authorization.RoleWriter,
+	"rw":             authorization.RoleWriter,
+	permissionWorker: authorization.RoleWorker,
+	permissionAdmin:  authorization.RoleAdmin,
+}
+
+// parseRole parses a case-insensitive role name or alias, roles combined with "+" (e.g. "read+worker")
+// are merged into one Role bitmask. Unknown names are an error, never RoleUndefined.
+func parseRole(permission string) (authorization.Role, error) {
+	role := authorization.RoleUndefined
+	for _, name := range strings.Split(permission, "+") {
+		r, ok := permissionRoles[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return authorization.RoleUndefined, fmt.Errorf(
+				"unknown role %q - expected read, write, worker or admin (aliases reader, ro, writer, rw), combined with \"+\"", permission)
+		}
+		role |= r
+	}
+	return role, nil
+}
+
+// roleToPermission is the inverse of parseRole, a role with several bits is joined by "+"
+func roleToPermission(role authorization.Role) string {
+	var names []string
+	for _, r := range []struct {
+		role authorization.Role
+		name string
+	}{
+		{authorization.RoleWorker, permissionWorker},
+		{authorization.RoleReader, permissionRead},
+		{authorization.RoleWriter, permissionWrite},
+		{authorization.RoleAdmin, permissionAdmin},
+	} {
+		if role&r.role != 0 {
+			names = append(names, r.name)
+		}
 	}
-	return authorization.RoleUndefined
+	return strings.Join(names, "+")
+}
+
+// globMatch reports whether s matches pattern, "*" matches any characters (including "/"), "?" a single one
+func globMatch(pattern, s string) bool {
+	px, sx := 0, 0
+	// position of the last "*" and the s position it is matched up to
+	star, starS := -1, 0
+	for sx < len(s) {
+		switch {
+		case px < len(pattern) && pattern[px] == '*':
+			star, starS = px, sx
+			px++
+		case px < len(pattern) && (pattern[px] == '?' || pattern[px] == s[sx]):
+			px++
+			sx++
+		case star >= 0:
+			px = star + 1
+			starS++
+			sx = starS
+		default:
+			return false
+		}
+	}
+	for px < len(pattern) && pattern[px] == '*' {
+		px++
+	}
+	return px == len(pattern)
 }
 
 func hasClaims(c *authorization.Claims) bool {
-	return c != nil && (c.System != authorization.RoleUndefined || len(c.Namespaces) > 0)
+	return c != nil && (c.System != authorization.RoleUndefined || len(c.Namespaces) > 0 || len(namespacePatterns(c)) > 0)
+}
+
+// terminalError stops MultiClaimMapper from asking the next claim mappers,
+// e.g. a revoked key must not be accepted by any of them.
+type terminalError struct {
+	error
+}
+
+func newTerminalError(err error) error {
+	return &terminalError{error: err}
+}
+
+func (e *terminalError) Unwrap() error {
+	return e.error
+}
+
+func isTerminalError(err error) bool {
+	var terminal *terminalError
+	return errors.As(err, &terminal)
+}
+
+// reasons a claim mapper rejects credentials with, a bounded set exported as the reason label of claim mapper metrics
+const (
+	// reasonChecksum is a structured key with a wrong checksum, most likely a typo
+	reasonChecksum = "checksum"
+	// reasonMalformed is a structured key or a JWT which cannot be parsed
+	reasonMalformed = "malformed"
+	// reasonInvalidSecret is a known key ID with a wrong secret, a guess rather than a typo
+	reasonInvalidSecret = "invalid_secret"
+	reasonRevoked       = "revoked"
+	reasonExpired       = "expired"
+	reasonNotYetValid   = "not_yet_valid"
+	// reasonSecondaryCredential is a missing or conflicting secondary credential
+	reasonSecondaryCredential = "secondary_credential"
+	// reasonOther is any other rejection
+	reasonOther = "other"
+)
+
+// reasonError labels a rejection with one of the reasons above
+type reasonError struct {
+	error
+	reason string
+}
+
+func withReason(reason string, err error) error {
+	return &reasonError{error: err, reason: reason}
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.error
+}
+
+// rejectionReason is the reason of a claim mapper error, reasonOther if it has none
+func rejectionReason(err error) string {
+	var labeled *reasonError
+	switch {
+	case errors.As(err, &labeled):
+		return labeled.reason
+	case errors.Is(err, errAPIKeyChecksum):
+		return reasonChecksum
+	case errors.Is(err, errAPIKeyMalformed), errors.Is(err, errMalformedJWT):
+		return reasonMalformed
+	}
+	return reasonOther
 }
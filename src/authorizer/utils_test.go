@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.temporal.io/server/common/authorization"
 )
 
@@ -70,3 +71,43 @@ func TestHasClaims_WithSystemRoleAndNilNamespaces(t *testing.T) {
 	result := hasClaims(claims)
 	assert.True(t, result)
 }
+
+func TestRoleToPermission(t *testing.T) {
+	assert.Equal(t, "", roleToPermission(authorization.RoleUndefined))
+	assert.Equal(t, "read", roleToPermission(authorization.RoleReader))
+	assert.Equal(t, "admin", roleToPermission(authorization.RoleAdmin))
+	assert.Equal(t, "worker+write", roleToPermission(authorization.RoleWorker|authorization.RoleWriter))
+	for _, p := range []string{permissionRead, permissionWrite, permissionWorker, permissionAdmin, "worker+read+admin"} {
+		role, err := parseRole(p)
+		require.NoError(t, err)
+		assert.Equal(t, p, roleToPermission(role))
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything/at/all", true},
+		{"team-a-*", "team-a-prod", true},
+		{"team-a-*", "team-b-prod", false},
+		{"*Terminate*", "/temporal.api.workflowservice.v1.WorkflowService/TerminateWorkflowExecution", true},
+		{"*Terminate*", "StartWorkflowExecution", false},
+		{"ns?", "ns1", true},
+		{"ns?", "ns12", false},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"*-prod", "team-a-prod", true},
+		{"**", "x", true},
+		{"exact", "exact", true},
+		{"exact", "Exact", false},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.match, globMatch(tc.pattern, tc.s), "%q ~ %q", tc.pattern, tc.s)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ilubenets/temporal-apikey/src/authorizer"
+)
+
+const apiKeyUsage = `Usage: temporal-server apikey <command> [flags]
+
+Commands:
+  generate <keyID>     create a new structured key and its secret hash
+  hash                 print the stored form of a secret read from stdin
+  validate             lint a TEMPORAL_API_KEYS string read from stdin (or -file registry) and show the keys it defines
+  list                 show the keys configured by TEMPORAL_API_KEYS and TEMPORAL_API_KEYS_FILE
+
+Run "temporal-server apikey <command> -h" for the flags of a command.
+`
+
+// errUsage is reported with exit code 2, other errors with 1
+var errUsage = errors.New("usage")
+
+// runAPIKeyCommand runs "apikey <command>" and returns the process exit code
+func runAPIKeyCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, apiKeyUsage)
+		return 2
+	}
+	var err error
+	switch args[0] {
+	case "generate":
+		err = apiKeyGenerate(args[1:], stdout, stderr)
+	case "hash":
+		err = apiKeyHash(args[1:], stdin, stdout, stderr)
+	case "validate":
+		err = apiKeyValidate(args[1:], stdin, stdout, stderr)
+	case "list":
+		err = apiKeyList(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		_, _ = fmt.Fprint(stdout, apiKeyUsage)
+		return 0
+	default:
+		_, _ = fmt.Fprintf(stderr, "unknown apikey command %q\n\n%s", args[0], apiKeyUsage)
+		return 2
+	}
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		_, _ = fmt.Fprintln(stderr, err)
+		return 2
+	}
+	_, _ = fmt.Fprintln(stderr, "error:", err)
+	return 1
+}
+
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("apikey "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: temporal-server apikey %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", "text", "output format: text or json")
+}
+
+func checkOutput(output string) error {
+	if output != "text" && output != "json" {
+		return fmt.Errorf("%w: -o must be text or json, got %q", errUsage, output)
+	}
+	return nil
+}
+
+func apiKeyGenerate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("generate", "<keyID>", stderr)
+	scheme := fs.String("scheme", "sha256", "secret hash scheme: sha256, argon2id or bcrypt")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: generate expects exactly one key ID", errUsage)
+	}
+	keyID := fs.Arg(0)
+	token, secret, err := authorizer.GenerateAPIKey(keyID)
+	if err != nil {
+		return err
+	}
+	hash, err := authorizer.HashAPIKeySecret(secret, *scheme)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return writeJSON(stdout, map[string]string{"id": keyID, "token": token, "secretHash": hash})
+	}
+	_, err = fmt.Fprintf(stdout, `API key (shown once, give it to the client):
+  %s
+
+TEMPORAL_API_KEYS entry:
+  %s%s:<role>:<namespace>
+
+TEMPORAL_API_KEYS_FILE entry:
+  - id: %s
+    secretHash: %q
+    namespaces:
+      <namespace>: <role>
+`, token, keyID, hash, keyID, hash)
+	return err
+}
+
+func apiKeyHash(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("hash", "< secret", stderr)
+	scheme := fs.String("scheme", "sha256", "secret hash scheme: sha256, argon2id or bcrypt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		// an argument would put the secret in the process list and the shell history
+		return fmt.Errorf("%w: hash reads the secret from stdin, e.g. hash < secret.txt", errUsage)
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	secret := strings.TrimRight(line, "\r\n")
+	hash, err := authorizer.HashAPIKeySecret(secret, *scheme)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, hash)
+	return err
+}
+
+func apiKeyValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", "< keys", stderr)
+	file := fs.String("file", "", "validate a TEMPORAL_API_KEYS_FILE registry instead of a TEMPORAL_API_KEYS string from stdin")
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		// an argument would put plaintext keys in the process list and the shell history
+		return fmt.Errorf("%w: validate reads the keys string from stdin, e.g. validate < keys.txt", errUsage)
+	}
+
+	var report *authorizer.APIKeysReport
+	var err error
+	if *file != "" {
+		report, err = authorizer.InspectAPIKeysFile(*file, time.Now())
+	} else {
+		var data []byte
+		if data, err = io.ReadAll(stdin); err != nil {
+			return err
+		}
+		report, err = authorizer.InspectAPIKeys(strings.TrimSpace(string(data)), time.Now())
+	}
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return writeJSON(stdout, report)
+	}
+	return writeReport(stdout, report)
+}
+
+func apiKeyList(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("list", "", stderr)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(*output); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: list takes no arguments", errUsage)
+	}
+
+	reports := map[string]*authorizer.APIKeysReport{}
+	if apiKeys := os.Getenv("TEMPORAL_API_KEYS"); apiKeys != "" {
+		report, err := authorizer.InspectAPIKeys(apiKeys, time.Now())
+		if err != nil {
+			return fmt.Errorf("TEMPORAL_API_KEYS: %w", err)
+		}
+		reports["TEMPORAL_API_KEYS"] = report
+	}
+	if apiKeysFile := os.Getenv("TEMPORAL_API_KEYS_FILE"); apiKeysFile != "" {
+		report, err := authorizer.InspectAPIKeysFile(apiKeysFile, time.Now())
+		if err != nil {
+			return fmt.Errorf("TEMPORAL_API_KEYS_FILE: %w", err)
+		}
+		reports["TEMPORAL_API_KEYS_FILE"] = report
+	}
+	if len(reports) == 0 {
+		return errors.New("neither TEMPORAL_API_KEYS nor TEMPORAL_API_KEYS_FILE is set")
+	}
+	if *output == "json" {
+		return writeJSON(stdout, reports)
+	}
+	for _, source := range []string{"TEMPORAL_API_KEYS", "TEMPORAL_API_KEYS_FILE"} {
+		if report, ok := reports[source]; ok {
+			_, _ = fmt.Fprintf(stdout, "# %s\n", source)
+			if err := writeReport(stdout, report); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeReport prints one key per line, namespaces as "<namespace>=<role>"
+func writeReport(w io.Writer, report *authorizer.APIKeysReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tSCHEME\tSYSTEM\tNAMESPACES\tEXPIRES")
+	for _, key := range report.Keys {
+		namespaces := make([]string, 0, len(key.Namespaces))
+		for ns, role := range key.Namespaces {
+			namespaces = append(namespaces, ns+"="+role)
+		}
+		slices.Sort(namespaces)
+		expires := "-"
+		if key.ExpiresAt != nil {
+			expires = key.ExpiresAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			key.ID, key.Scheme, orDash(key.SystemRole), orDash(strings.Join(namespaces, ",")), expires)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, r := range report.Revoked {
+		_, _ = fmt.Fprintf(w, "revoked: %s %s\n", r.Key, r.Reason)
+	}
+	for _, warning := range report.Warnings {
+		_, _ = fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	_, err := fmt.Fprintf(w, "%d key(s), %d revoked\n", len(report.Keys), len(report.Revoked))
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
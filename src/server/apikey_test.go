@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ilubenets/temporal-apikey/src/authorizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAPIKeyCommand(t *testing.T) {
+	hash, err := authorizer.HashAPIKeySecret("s3cret", "sha256")
+	require.NoError(t, err)
+	registry := filepath.Join(t.TempDir(), "api-keys.yaml")
+	require.NoError(t, os.WriteFile(registry, []byte(`keys:
+  - id: ci-bot
+    secretHash: "`+hash+`"
+    namespaces:
+      orders: write
+`), 0o600))
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		exitCode   int
+		stdout     []string
+		stderr     []string
+		noSecretIn string
+	}{
+		{name: "no command", exitCode: 2, stderr: []string{"Usage: temporal-server apikey"}},
+		{name: "help", args: []string{"help"}, stdout: []string{"Commands:"}},
+		{name: "unknown command", args: []string{"rotate"}, exitCode: 2, stderr: []string{`unknown apikey command "rotate"`}},
+		{name: "command help", args: []string{"generate", "-h"}, stderr: []string{"Usage: temporal-server apikey generate"}},
+
+		{name: "generate", args: []string{"generate", "ci-bot"}, stdout: []string{"API key (shown once", "ci-bot$sha256$", "- id: ci-bot"}},
+		{name: "generate without key ID", args: []string{"generate"}, exitCode: 2, stderr: []string{"generate expects exactly one key ID"}},
+		{name: "generate bad output", args: []string{"generate", "-o", "yaml", "ci-bot"}, exitCode: 2, stderr: []string{"-o must be text or json"}},
+		{name: "generate bad scheme", args: []string{"generate", "-scheme", "md5", "ci-bot"}, exitCode: 1, stderr: []string{"error:", "md5"}},
+		{name: "generate bad key ID", args: []string{"generate", "ci bot"}, exitCode: 1, stderr: []string{"error:"}},
+
+		{name: "hash", args: []string{"hash"}, stdin: "s3cret", stdout: []string{"$sha256$"}, noSecretIn: "s3cret"},
+		{name: "hash stdin", args: []string{"hash", "-scheme", "argon2id"}, stdin: "s3cret\n", stdout: []string{"$argon2id$v=19$"}, noSecretIn: "s3cret"},
+		{name: "hash empty secret", args: []string{"hash"}, exitCode: 1, stderr: []string{"error:"}},
+		{name: "hash argument", args: []string{"hash", "s3cret"}, exitCode: 2, stderr: []string{"hash reads the secret from stdin"}},
+
+		{name: "validate stdin", args: []string{"validate"}, stdin: "ci-bot" + hash + ":write:orders\n", stdout: []string{"ci-bot", "orders=write", "1 key(s), 0 revoked"}},
+		{name: "validate plaintext key", args: []string{"validate"}, stdin: "pl41n-s3cret:read:orders", stdout: []string{"orders=read"}, noSecretIn: "pl41n-s3cret"},
+		{name: "validate invalid", args: []string{"validate"}, stdin: "ci-bot:wrtie:orders", exitCode: 1, stderr: []string{"error:"}},
+		{name: "validate argument", args: []string{"validate", "ci-bot:write:orders"}, exitCode: 2, stderr: []string{"validate reads the keys string from stdin"}},
+		{name: "validate file", args: []string{"validate", "-file", registry}, stdout: []string{"ci-bot", "sha256", "orders=write"}},
+		{name: "validate missing file", args: []string{"validate", "-file", filepath.Join(t.TempDir(), "missing.yaml")}, exitCode: 1, stderr: []string{"error:"}},
+
+		{name: "list arguments", args: []string{"list", "extra"}, exitCode: 2, stderr: []string{"list takes no arguments"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			exitCode := runAPIKeyCommand(tc.args, strings.NewReader(tc.stdin), &stdout, &stderr)
+			assert.Equal(t, tc.exitCode, exitCode, "stderr: %s", stderr.String())
+			for _, s := range tc.stdout {
+				assert.Contains(t, stdout.String(), s)
+			}
+			for _, s := range tc.stderr {
+				assert.Contains(t, stderr.String(), s)
+			}
+			if tc.noSecretIn != "" {
+				assert.NotContains(t, stdout.String()+stderr.String(), tc.noSecretIn)
+			}
+		})
+	}
+}
+
+func TestRunAPIKeyCommand_JSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, runAPIKeyCommand([]string{"generate", "-o", "json", "ci-bot"}, strings.NewReader(""), &stdout, &stderr), stderr.String())
+	var generated map[string]string
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &generated))
+	assert.Equal(t, "ci-bot", generated["id"])
+	assert.True(t, strings.HasPrefix(generated["token"], "tmprl_ci-bot_"), generated["token"])
+
+	stdout.Reset()
+	spec := "ci-bot" + generated["secretHash"] + ":write:orders"
+	require.Equal(t, 0, runAPIKeyCommand([]string{"validate", "-o", "json"}, strings.NewReader(spec), &stdout, &stderr), stderr.String())
+	var report authorizer.APIKeysReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	require.Len(t, report.Keys, 1)
+	assert.Equal(t, "ci-bot", report.Keys[0].ID)
+	assert.Equal(t, "write", report.Keys[0].Namespaces["orders"])
+}
+
+func TestRunAPIKeyCommand_List(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	t.Setenv("TEMPORAL_API_KEYS", "")
+	t.Setenv("TEMPORAL_API_KEYS_FILE", "")
+	assert.Equal(t, 1, runAPIKeyCommand([]string{"list"}, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "neither TEMPORAL_API_KEYS nor TEMPORAL_API_KEYS_FILE is set")
+
+	stdout.Reset()
+	t.Setenv("TEMPORAL_API_KEYS", "admin-s3cret:admin:*")
+	assert.Equal(t, 0, runAPIKeyCommand([]string{"list"}, nil, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "# TEMPORAL_API_KEYS")
+	assert.NotContains(t, stdout.String(), "admin-s3cret")
+
+	t.Setenv("TEMPORAL_API_KEYS", "broken")
+	assert.Equal(t, 1, runAPIKeyCommand([]string{"list"}, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "error: TEMPORAL_API_KEYS:")
+}
@@ -1,20 +1,36 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ilubenets/temporal-apikey/src/authorizer"
 	"go.temporal.io/server/common/authorization"
 	"go.temporal.io/server/common/config"
 	logpkg "go.temporal.io/server/common/log"
+	"go.temporal.io/server/common/metrics"
 	"go.temporal.io/server/common/primitives"
 	"go.temporal.io/server/temporal"
 )
 
 func main() {
+	// set before any key is parsed, "apikey list" then shows the IDs the server logs
+	if pepper := os.Getenv("TEMPORAL_API_KEYS_PEPPER"); pepper != "" {
+		if err := authorizer.SetAPIKeyPepper(pepper); err != nil {
+			log.Fatalf("TEMPORAL_API_KEYS_PEPPER: %v", err)
+		}
+	}
+	// "apikey ..." manages keys offline, without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKeyCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	logger := logpkg.NewZapLogger(logpkg.BuildZapLogger(logpkg.Config{Level: "info"}))
 
 	env := os.Getenv(config.EnvKeyEnvironment)
@@ -36,33 +52,205 @@ func main() {
 		log.Fatalf("config [%s/%s.yaml] not found or corrupted: %v", configDirPath, env, err)
 	}
 
+	authCfg := &authorizer.Config{}
+	if authConfigFile := os.Getenv("TEMPORAL_AUTH_CONFIG_FILE"); authConfigFile != "" {
+		if authCfg, err = authorizer.LoadConfig(authConfigFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// the server emits its own metrics through the same handler, configured by global.metrics
+	metricsHandler, err := metrics.MetricsHandlerFromConfig(logger, cfg.Global.Metrics)
+	if err != nil {
+		log.Fatalf("metrics: %v", err)
+	}
+	authMetrics := authorizer.NewAuthMetrics(metricsHandler)
+
 	claimMappers := authorizer.NewMultiClaimMapper(logger)
+	claimMappers.SetMetrics(authMetrics)
 	// Prefer API key processing first so JWT errors do not short-circuit
+	var apiKeyClaimMapper authorization.ClaimMapper
 	if apiKeys := os.Getenv("TEMPORAL_API_KEYS"); apiKeys != "" {
-		apiKeyClaimMapper, err := authorizer.NewAPIKeyClaimMapper(apiKeys, logger)
-		if err != nil {
+		if apiKeyClaimMapper, err = authorizer.NewAPIKeyClaimMapper(apiKeys, logger); err != nil {
 			log.Fatalf("ApiKeyClaimMapper: %v", err)
 		}
 		claimMappers.Add("apiKeyClaimMapper", apiKeyClaimMapper)
 	}
+	if apiKeysFile := os.Getenv("TEMPORAL_API_KEYS_FILE"); apiKeysFile != "" {
+		apiKeyFileClaimMapper, err := authorizer.NewAPIKeyFileClaimMapper(apiKeysFile, logger)
+		if err != nil {
+			log.Fatalf("ApiKeyFileClaimMapper: %v", err)
+		}
+		claimMappers.Add("apiKeyFileClaimMapper", apiKeyFileClaimMapper)
+		// the revoked list of the file applies to the keys of TEMPORAL_API_KEYS too
+		if apiKeyClaimMapper != nil {
+			if err := authorizer.ShareAPIKeyRevocations(apiKeyClaimMapper, apiKeyFileClaimMapper); err != nil {
+				log.Fatalf("ApiKeyFileClaimMapper: %v", err)
+			}
+		}
+
+		// reload on SIGHUP and, if configured, when the file changes
+		var reloadInterval time.Duration
+		if v := os.Getenv("TEMPORAL_API_KEYS_RELOAD_INTERVAL"); v != "" {
+			if reloadInterval, err = time.ParseDuration(v); err != nil {
+				log.Fatalf("TEMPORAL_API_KEYS_RELOAD_INTERVAL: %v", err)
+			}
+		}
+		if reloader, ok := apiKeyFileClaimMapper.(authorizer.Reloader); ok {
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			go authorizer.WatchReload(context.Background(), reloader, hup, apiKeysFile, reloadInterval, logger)
+		}
+	}
+
+	// mTLS client certificates, e.g. of workers which do not send a bearer token
+	if authCfg.TLSClaimMapping != nil {
+		tlsClaimMapper, err := authorizer.NewTLSClaimMapper(*authCfg.TLSClaimMapping, logger)
+		if err != nil {
+			log.Fatalf("tlsClaimMapping: %v", err)
+		}
+		claimMappers.Add("tlsClaimMapper", tlsClaimMapper)
+	}
+
+	// verified JWT claims are cached, a token is verified once until it expires
+	var jwtCacheCfg authorizer.JWTCacheConfig
+	if authCfg.JWTCache != nil {
+		jwtCacheCfg = *authCfg.JWTCache
+	}
+	defaultJWT := strings.EqualFold(cfg.Global.Authorization.ClaimMapper, "default")
+	var tokenKeyProvider authorization.TokenKeyProvider
+	if defaultJWT || authCfg.JWTClaimMapping != nil {
+		tokenKeyProvider = authorization.NewDefaultTokenKeyProvider(&cfg.Global.Authorization, logger)
+	}
+	// issuer tokens are only mapped by jwtIssuerClaimMapper, the default JWT claim mapper would grant their
+	// permissions claim without the claim mapping, maxRole and clockSkew of the issuer
+	var issuerKeyProvider *authorizer.JWTIssuerKeyProvider
+	if len(authCfg.JWTIssuers) > 0 {
+		if issuerKeyProvider, err = authorizer.NewJWTIssuerKeyProvider(authCfg.JWTIssuers, authCfg.JWTClaimMapping, logger); err != nil {
+			log.Fatalf("jwtIssuers: %v", err)
+		}
+		if tokenKeyProvider != nil {
+			if err := issuerKeyProvider.CheckKeySources(cfg.Global.Authorization.JWTKeyProvider.KeySourceURIs); err != nil {
+				log.Fatalf("jwtIssuers: %v", err)
+			}
+		}
+	}
 
-	if strings.EqualFold(cfg.Global.Authorization.ClaimMapper, "default") {
-		jwtClaimMapper := authorization.NewDefaultJWTClaimMapper(
-			authorization.NewDefaultTokenKeyProvider(&cfg.Global.Authorization, logger), &cfg.Global.Authorization, logger,
+	if defaultJWT {
+		var jwtClaimMapper authorization.ClaimMapper = authorization.NewDefaultJWTClaimMapper(
+			tokenKeyProvider, &cfg.Global.Authorization, logger,
 		)
-		claimMappers.Add("defaultJWTClaimMapper", jwtClaimMapper)
-		claimMappers.Add("extraDataJWTClamMapper", authorizer.NewExtraDataJWTClamMapper(jwtClaimMapper, logger))
+		// extraDataJWTClamMapper checks "Authorization-Extras" through the same cache
+		if jwtClaimMapper, err = authorizer.NewJWTClaimsCache(authorizer.DefaultJWTClaimMapperName, jwtClaimMapper, jwtCacheCfg, authMetrics); err != nil {
+			log.Fatalf("jwtCache: %v", err)
+		}
+		claimMappers.Add(authorizer.DefaultJWTClaimMapperName, jwtClaimMapper)
+		claimMappers.Add("extraDataJWTClamMapper", authorizer.NewExtraDataJWTClamMapper(jwtClaimMapper, logger, tokenKeyProvider.SupportedMethods()...))
 	}
 
+	// groups and roles of JWTs from identity providers without a permissions claim
+	switch {
+	case issuerKeyProvider != nil:
+		// every issuer has its own keys, audience and claim mapping, jwtClaimMapping is the default mapping
+		jwtIssuerClaimMapper := authorizer.NewJWTIssuerClaimMapper(issuerKeyProvider, logger)
+		if jwtIssuerClaimMapper, err = authorizer.NewJWTClaimsCache("jwtIssuerClaimMapper", jwtIssuerClaimMapper, jwtCacheCfg, authMetrics); err != nil {
+			log.Fatalf("jwtCache: %v", err)
+		}
+		claimMappers.Add("jwtIssuerClaimMapper", jwtIssuerClaimMapper)
+	case authCfg.JWTClaimMapping != nil:
+		jwtRoleClaimMapper, err := authorizer.NewJWTRoleClaimMapper(tokenKeyProvider, *authCfg.JWTClaimMapping, logger)
+		if err != nil {
+			log.Fatalf("jwtClaimMapping: %v", err)
+		}
+		if jwtRoleClaimMapper, err = authorizer.NewJWTClaimsCache("jwtRoleClaimMapper", jwtRoleClaimMapper, jwtCacheCfg, authMetrics); err != nil {
+			log.Fatalf("jwtCache: %v", err)
+		}
+		claimMappers.Add("jwtRoleClaimMapper", jwtRoleClaimMapper)
+	}
+
+	// e.g. a service API key in "Authorization-Extras" along with the user JWT, the primary mapper is replaced in place
+	for _, credential := range authCfg.SecondaryCredentials {
+		primary, secondary := claimMappers.ClaimMapper(credential.Primary), claimMappers.ClaimMapper(credential.Secondary)
+		if primary == nil || secondary == nil {
+			log.Fatalf("secondaryCredentials: claim-mappers %q and %q must be enabled", credential.Primary, credential.Secondary)
+		}
+		secondaryCredentialClaimMapper, err := authorizer.NewSecondaryCredentialClaimMapper(primary, secondary, credential, logger)
+		if err != nil {
+			log.Fatalf("secondaryCredentials: %v", err)
+		}
+		claimMappers.Add(credential.Primary, secondaryCredentialClaimMapper)
+		if credential.RequiresBoth() {
+			// asked first, the mappers registered before it could otherwise accept the primary credential alone
+			if err := claimMappers.SetOrder(credential.Primary); err != nil {
+				log.Fatalf("secondaryCredentials: %v", err)
+			}
+			// extraDataJWTClamMapper checks "Authorization-Extras" with the default JWT claim mapper alone,
+			// it would accept the primary credential sent there without the secondary one
+			if credential.Primary == authorizer.DefaultJWTClaimMapperName && claimMappers.Remove("extraDataJWTClamMapper") {
+				logger.Warn("auth: extraDataJWTClamMapper disabled, defaultJWTClaimMapper requires a secondary credential")
+			}
+		}
+	}
+
+	for name, policy := range authCfg.ClaimMapperPolicies {
+		if err := claimMappers.SetPolicy(name, policy); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// e.g. "apiKeyClaimMapper,apiKeyFileClaimMapper,defaultJWTClaimMapper", default is the registration order above
+	if order := os.Getenv("TEMPORAL_CLAIM_MAPPERS_ORDER"); order != "" {
+		names := strings.Split(order, ",")
+		for i := range names {
+			names[i] = strings.TrimSpace(names[i])
+		}
+		if err := claimMappers.SetOrder(names...); err != nil {
+			log.Fatalf("TEMPORAL_CLAIM_MAPPERS_ORDER: %v", err)
+		}
+	}
+
+	if strategy := os.Getenv("TEMPORAL_CLAIM_MAPPERS_STRATEGY"); strategy != "" {
+		mergeStrategy, err := authorizer.ParseMergeStrategy(strategy)
+		if err != nil {
+			log.Fatalf("TEMPORAL_CLAIM_MAPPERS_STRATEGY: %v", err)
+		}
+		claimMappers.SetStrategy(mergeStrategy)
+	}
+
+	temporalAuthorizer := authorizer.NewNamespacePatternAuthorizer(authorization.NewDefaultAuthorizer())
+	if len(authCfg.AuthorizationRules) > 0 {
+		if temporalAuthorizer, err = authorizer.NewRuleAuthorizer(authCfg.AuthorizationRules, temporalAuthorizer); err != nil {
+			log.Fatal(err)
+		}
+	}
+	temporalAuthorizer = authorizer.NewMetricsAuthorizer(temporalAuthorizer, authMetrics)
+
+	// audit log of every authorization decision, written asynchronously by the auditor
+	var auditor *authorizer.Auditor
+	if authCfg.Audit != nil {
+		auditSink, err := authorizer.NewAuditSink(*authCfg.Audit)
+		if err != nil {
+			log.Fatalf("audit: %v", err)
+		}
+		auditor = authorizer.NewAuditor(auditSink, authCfg.Audit.BufferSize, logger)
+		claimMappers.SetDeferRejections(true)
+		temporalAuthorizer = authorizer.NewAuditAuthorizer(temporalAuthorizer, auditor)
+	}
+
+	// per API key (and, with subjectRateLimit, per JWT subject) request rate, runs after the claims are mapped
+	rateLimiter := authorizer.NewRateLimitInterceptor(authCfg.SubjectRateLimit, logger)
+
 	s, err := temporal.NewServer(
 		temporal.ForServices([]string{
 			string(primitives.FrontendService),
 		}),
 		temporal.WithConfig(cfg),
+		temporal.WithCustomMetricsHandler(metricsHandler),
 		temporal.InterruptOn(temporal.InterruptCh()),
-		temporal.WithAuthorizer(authorization.NewDefaultAuthorizer()),
+		temporal.WithAuthorizer(temporalAuthorizer),
 		// customer claim manager
 		temporal.WithClaimMapper(func(*config.Config) authorization.ClaimMapper { return claimMappers }),
+		temporal.WithChainedFrontendGrpcInterceptors(rateLimiter.Intercept),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -72,4 +260,12 @@ func main() {
 	if err := s.Start(); err != nil {
 		log.Fatal(err)
 	}
+	if auditor != nil {
+		if err := auditor.Close(); err != nil {
+			log.Printf("audit: %v", err)
+		}
+	}
+	if issuerKeyProvider != nil {
+		issuerKeyProvider.Close()
+	}
 }
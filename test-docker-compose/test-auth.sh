@@ -126,7 +126,7 @@ check_oauth_server
 
 echo -e "${BLUE}Step 2: Test API Key Authentication${NC}"
 echo -e "${BLUE}========================================${NC}"
-test_api_key "admin-key" "Admin API Key (admin:*)"
+test_api_key "admin-key" "Admin API Key (admin:@system)"
 test_api_key "test-key" "Service API Key (service:default)"
 test_api_key "invalid-key" "Invalid API Key (should fail)"
 